@@ -0,0 +1,355 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/mitchellh/go-homedir"
+	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
+	"github.com/rclone/rclone/fs"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tidwall/pretty"
+
+	"github.com/bringg/honey/pkg/config"
+	"github.com/bringg/honey/pkg/place"
+	"github.com/bringg/honey/pkg/place/cache"
+	"github.com/bringg/honey/pkg/place/operations"
+	"github.com/bringg/honey/pkg/place/query"
+)
+
+type (
+	// cacheEntry is an entry of honey cache list
+	cacheEntry struct {
+		Backend string `json:"backend"`
+		Key     string `json:"key"`
+		Size    int64  `json:"size"`
+		TTL     string `json:"ttl"`
+	}
+
+	// cacheInfo describes a store of honey cache info
+	cacheInfo struct {
+		Store     string `json:"store"`
+		Backend   string `json:"backend"`
+		Location  string `json:"location"`
+		Encrypted bool   `json:"encrypted"`
+		// Fallback is why the store configured isn't used
+		Fallback string `json:"fallback,omitempty"`
+	}
+
+	// cacheStats are the stats of a backend of honey cache stats
+	cacheStats struct {
+		Backend string `json:"backend"`
+		Entries int    `json:"entries"`
+		Size    int64  `json:"size"`
+		MinTTL  string `json:"min_ttl"`
+		MaxTTL  string `json:"max_ttl"`
+	}
+)
+
+// the environment variables of the cache passwords
+const (
+	cachePasswordEnv    = "HONEY_CACHE_PASSWORD"
+	cacheNewPasswordEnv = "HONEY_CACHE_NEW_PASSWORD"
+)
+
+var (
+	// cacheOpt and indexOpt are the options the cache and the index are
+	// opened with
+	cacheOpt, indexOpt *cache.Options
+
+	cacheCommand = &cobra.Command{
+		Use:   "cache",
+		Short: `Inspect and purge the cache of the backends results.`,
+	}
+
+	cacheListCommand = &cobra.Command{
+		Use:   "list [backend]",
+		Short: `List the cache entries, of a single backend section if set.`,
+		RunE: func(command *cobra.Command, args []string) error {
+			CheckArgs(0, 1, command, args)
+			defer operations.CacheDB.Close()
+
+			bucket := ""
+			if len(args) > 0 {
+				bucket = args[0]
+			}
+
+			entries := make([]*cacheEntry, 0)
+			if err := operations.CacheDB.Iterate(bucket, func(e *cache.Entry) error {
+				entries = append(entries, &cacheEntry{
+					Backend: e.Bucket,
+					Key:     string(e.Key),
+					Size:    e.Size,
+					TTL:     formatTTL(e.ExpiresAt),
+				})
+
+				return nil
+			}); err != nil {
+				return err
+			}
+
+			rows := make([][]string, 0, len(entries))
+			for _, e := range entries {
+				rows = append(rows, []string{e.Backend, e.Key, fs.SizeSuffix(e.Size).String(), e.TTL})
+			}
+
+			return printCache(entries, []string{"backend", "key", "size", "ttl"}, rows)
+		},
+	}
+
+	cacheStatsCommand = &cobra.Command{
+		Use:   "stats",
+		Short: `Show the entries, size and remaining TTL of the cache per backend section.`,
+		RunE: func(command *cobra.Command, args []string) error {
+			CheckArgs(0, 0, command, args)
+			defer operations.CacheDB.Close()
+
+			stats, err := operations.CacheDB.Stats()
+			if err != nil {
+				return err
+			}
+
+			out := make([]*cacheStats, 0, len(stats))
+			rows := make([][]string, 0, len(stats))
+			for _, st := range stats {
+				s := &cacheStats{
+					Backend: st.Bucket,
+					Entries: st.Entries,
+					Size:    st.Size,
+					MinTTL:  st.MinTTL.Round(time.Second).String(),
+					MaxTTL:  st.MaxTTL.Round(time.Second).String(),
+				}
+
+				out = append(out, s)
+				rows = append(rows, []string{s.Backend, fmt.Sprint(s.Entries), fs.SizeSuffix(s.Size).String(), s.MinTTL, s.MaxTTL})
+			}
+
+			return printCache(out, []string{"backend", "entries", "size", "min ttl", "max ttl"}, rows)
+		},
+	}
+
+	cacheInfoCommand = &cobra.Command{
+		Use:   "info",
+		Short: `Show where the cache and the index of honey sync are kept and whether they are encrypted.`,
+		RunE: func(command *cobra.Command, args []string) error {
+			CheckArgs(0, 0, command, args)
+			defer operations.CacheDB.Close()
+
+			out := make([]*cacheInfo, 0, 2)
+			rows := make([][]string, 0, 2)
+			for _, s := range []struct {
+				name  string
+				store cache.Store
+			}{{"cache", operations.CacheDB}, {"index", operations.IndexDB}} {
+				info := s.store.Info()
+				i := &cacheInfo{
+					Store:     s.name,
+					Backend:   info.Backend,
+					Location:  info.Location,
+					Encrypted: info.Encrypted,
+					Fallback:  info.Fallback,
+				}
+
+				out = append(out, i)
+				rows = append(rows, []string{i.Store, i.Backend, i.Location, fmt.Sprint(i.Encrypted), i.Fallback})
+			}
+
+			return printCache(out, []string{"store", "backend", "location", "encrypted", "fallback"}, rows)
+		},
+	}
+
+	cacheRotateKeyCommand = &cobra.Command{
+		Use:   "rotate-key",
+		Short: `Encrypt the cache and the index with a new password.`,
+		Long: `Encrypt the cache and the index of honey sync with a new password,
+read from $` + cacheNewPasswordEnv + ` or asked for. The current
+password is read from $` + cachePasswordEnv + `, or asked for with
+--cache-encrypt. An unencrypted cache has its entries rewritten
+encrypted, the unencrypted ones are deleted. A rotation which failed
+or was interrupted is resumed by running it again with the same new
+password.
+
+No other honey may use the cache meanwhile, e.g. honey serve.`,
+		RunE: func(command *cobra.Command, args []string) error {
+			CheckArgs(0, 0, command, args)
+
+			// the stores are rewritten, they mustn't be open
+			if err := operations.CacheDB.Close(); err != nil {
+				return err
+			}
+
+			password, ok := os.LookupEnv(cacheNewPasswordEnv)
+			if !ok {
+				password = config.ChangePassword("the new cache")
+			}
+
+			if err := cache.RotateKey(cacheOpt, password); err != nil {
+				return errors.Wrap(err, "can't rotate the key of the cache")
+			}
+
+			if err := cache.RotateKey(indexOpt, password); err != nil {
+				return errors.Wrap(err, "can't rotate the key of the index")
+			}
+
+			fmt.Printf("the cache is encrypted with the new password, set $%s to it\n", cachePasswordEnv)
+
+			return nil
+		},
+	}
+
+	cachePurgeCommand = &cobra.Command{
+		Use:   "purge [backend] [pattern]",
+		Short: `Delete the cache entries, of a backend section and whose key matches the glob pattern if set.`,
+		Long: `Delete the cache entries. Without arguments the whole cache is
+deleted, with a backend section only its entries, and with a pattern
+only the entries of the section whose key matches the ` + "`*` and `?`" + `
+wildcards, e.g.
+
+    honey cache purge aws '*api*'
+
+The keys are shown by honey cache list.`,
+		RunE: func(command *cobra.Command, args []string) error {
+			CheckArgs(0, 2, command, args)
+			defer operations.CacheDB.Close()
+
+			if len(args) < 2 {
+				bucket := ""
+				if len(args) > 0 {
+					bucket = args[0]
+				}
+
+				return operations.CacheDB.DropPrefix(bucket, nil)
+			}
+
+			m, err := query.NewMatcher(args[1], query.MatchGlob, false)
+			if err != nil {
+				return err
+			}
+
+			keys := make([][]byte, 0)
+			if err := operations.CacheDB.Iterate(args[0], func(e *cache.Entry) error {
+				if m.Match(string(e.Key)) {
+					keys = append(keys, e.Key)
+				}
+
+				return nil
+			}); err != nil {
+				return err
+			}
+
+			for _, key := range keys {
+				if err := operations.CacheDB.Delete(args[0], key); err != nil {
+					return err
+				}
+			}
+
+			fmt.Printf("purged %d entries\n", len(keys))
+
+			return nil
+		},
+	}
+)
+
+func init() {
+	cacheCommand.AddCommand(cacheListCommand)
+	cacheCommand.AddCommand(cacheStatsCommand)
+	cacheCommand.AddCommand(cacheInfoCommand)
+	cacheCommand.AddCommand(cacheRotateKeyCommand)
+	cacheCommand.AddCommand(cachePurgeCommand)
+	cacheCommand.AddCommand(cacheRefreshCommand)
+}
+
+// openStores sets the cache and the index of the flags, they are opened
+// on first use. They are encrypted with the password of
+// $HONEY_CACHE_PASSWORD, or the one asked for with --cache-encrypt.
+func openStores(ci *place.ConfigInfo) {
+	password, ok := os.LookupEnv(cachePasswordEnv)
+	if !ok && ci.CacheEncrypt {
+		password = config.GetPassword("Enter the cache password:")
+
+		// for the detached refreshes
+		if err := os.Setenv(cachePasswordEnv, password); err != nil {
+			log.Fatalf("--cache-encrypt: %v", err)
+		}
+	}
+
+	cacheOpt = &cache.Options{
+		Backend:  ci.CacheBackend,
+		Dir:      ci.CacheDir,
+		RedisURL: ci.CacheRedisURL,
+		Password: password,
+	}
+
+	store, err := cache.NewStore(cacheOpt)
+	if err != nil {
+		log.Fatalf("--cache-backend: %v", err)
+	}
+
+	operations.CacheDB = store
+
+	// the index is kept locally whatever the cache backend, it must
+	// work offline
+	indexDir := ci.IndexDir
+	if indexDir == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			log.Fatalf("--index-dir: %v", err)
+		}
+
+		indexDir = filepath.Join(home, ".cache", "honey-index")
+	}
+
+	indexOpt = &cache.Options{
+		Backend:  cache.BackendFile,
+		Dir:      indexDir,
+		Password: password,
+	}
+
+	if operations.IndexDB, err = cache.NewStore(indexOpt); err != nil {
+		log.Fatalf("--index-dir: %v", err)
+	}
+}
+
+// printCache prints the data as json if the output format is json, as a
+// table of the rows otherwise
+func printCache(data interface{}, headers []string, rows [][]string) error {
+	ci := place.GetConfig(context.Background())
+	if !strings.HasPrefix(ci.OutFormat, "json") {
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader(headers)
+		table.AppendBulk(rows)
+		table.Render()
+
+		return nil
+	}
+
+	out, err := jsoniter.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	out = pretty.Pretty(out)
+	if !ci.NoColor {
+		out = pretty.Color(out, nil)
+	}
+
+	_, err = os.Stdout.Write(out)
+
+	return err
+}
+
+// formatTTL returns the time left until the expiry, never if zero
+func formatTTL(expiresAt time.Time) string {
+	if expiresAt.IsZero() {
+		return "never"
+	}
+
+	return time.Until(expiresAt).Round(time.Second).String()
+}
@@ -0,0 +1,17 @@
+// Detach the refresh process for OSes which support sessions
+
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package cmd
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detach runs the command in its own session, it isn't killed with
+// the terminal of honey
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
@@ -0,0 +1,11 @@
+// Detach the refresh process for OSes without sessions
+
+//go:build plan9
+// +build plan9
+
+package cmd
+
+import "os/exec"
+
+// detach does nothing, the command is a child of honey
+func detach(cmd *exec.Cmd) {}
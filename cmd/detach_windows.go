@@ -0,0 +1,21 @@
+// Detach the refresh process on windows
+
+//go:build windows
+// +build windows
+
+package cmd
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachedProcess is DETACHED_PROCESS, the process has no console
+const detachedProcess = 0x00000008
+
+// detach runs the command without a console in its own process group
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CreationFlags: detachedProcess | syscall.CREATE_NEW_PROCESS_GROUP,
+	}
+}
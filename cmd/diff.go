@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/spf13/cobra"
+
+	"github.com/bringg/honey/pkg/place"
+	"github.com/bringg/honey/pkg/place/operations"
+	"github.com/bringg/honey/pkg/place/printers"
+)
+
+var (
+	diffFields    string
+	diffRawFields string
+
+	diffCmd = &cobra.Command{
+		Use:   "diff <old snapshot> [<new snapshot>]",
+		Short: "Show the instances which appeared, disappeared or changed between two inventories",
+		Long: `Diff compares the snapshot of honey snapshot save with another one, or
+with a live search if only one is given, e.g. before and after a deploy.
+
+The instances are matched by their backend and id. The ones of one
+inventory only are added or removed, and the ones whose --fields or
+--raw-fields differ are changed.
+
+The backends are those set with --backends, those of the snapshots if
+unset. The search is the one of the --filter, that of the old snapshot
+if unset, everything otherwise.
+
+The output is a table, json or markdown, set with --output.`,
+		RunE: func(command *cobra.Command, args []string) error {
+			CheckArgs(1, 2, command, args)
+
+			ctx := context.TODO()
+			ci := place.GetConfig(ctx)
+
+			fields := fs.CommaSepList{}
+			if err := fields.Set(diffFields); err != nil {
+				return err
+			}
+
+			raw := fs.CommaSepList{}
+			if err := raw.Set(diffRawFields); err != nil {
+				return err
+			}
+
+			for _, path := range raw {
+				fields = append(fields, "raw."+strings.TrimPrefix(path, "raw."))
+			}
+
+			if len(fields) == 0 {
+				return errors.New("no field to compare, set --fields or --raw-fields")
+			}
+
+			oldPath, newPath := args[0], ""
+			if len(args) == 2 {
+				newPath = args[1]
+			}
+
+			backends, err := diffBackends(ci, oldPath, newPath)
+			if err != nil {
+				return err
+			}
+
+			patterns := filters
+			if len(patterns) == 0 {
+				if patterns, err = operations.SnapshotFilters(oldPath); err != nil {
+					return err
+				}
+			}
+
+			defer operations.CacheDB.Close()
+
+			prev, err := operations.Inventory(ctx, oldPath, backends, patterns)
+			if err != nil {
+				return err
+			}
+
+			cur, err := operations.Inventory(ctx, newPath, backends, patterns)
+			if err != nil {
+				return err
+			}
+
+			if err := printers.PrintDiff(&printers.PrintInput{
+				Format:  ci.OutFormat,
+				NoColor: ci.NoColor,
+			}, cur.Instances.DiffOn(prev.Instances, fields)); err != nil {
+				return err
+			}
+
+			if errs := append(prev.Errors, cur.Errors...); len(errs) > 0 {
+				printWarnings(errs, ci.NoColor)
+
+				return errPartialResults
+			}
+
+			return nil
+		},
+	}
+)
+
+// diffBackends returns the backends compared, those of --backends or of
+// the snapshots
+func diffBackends(ci *place.ConfigInfo, paths ...string) ([]string, error) {
+	backends, err := ci.Backends()
+	if err != nil || len(backends) > 0 {
+		return backends, err
+	}
+
+	seen := make(map[string]struct{})
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+
+		names, err := operations.SnapshotBackends(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range names {
+			if _, ok := seen[name]; !ok {
+				seen[name] = struct{}{}
+				backends = append(backends, name)
+			}
+		}
+	}
+
+	if len(backends) == 0 {
+		return nil, errors.New("no backend to compare, set --backends")
+	}
+
+	return backends, nil
+}
+
+func init() {
+	flags.StringVarP(diffCmd.Flags(), &diffFields, "fields", "", strings.Join(place.InventoryDiffFields, ","), "fields compared, e.g. labels or labels.env")
+	flags.StringVarP(diffCmd.Flags(), &diffRawFields, "raw-fields", "", "", "gjson paths of the raw instances compared too, e.g. instance_type")
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bringg/honey/pkg/place"
+	"github.com/bringg/honey/pkg/place/operations"
+	"github.com/bringg/honey/pkg/place/printers"
+)
+
+var getCmd = &cobra.Command{
+	Use:   "get <backend> <id>",
+	Short: "Show the full details of a single instance",
+	Long: `Get fetches a single instance by its id from the backend, without
+searching all of them and without the cache.
+
+The id is the one of the backend:
+
+- aws: the instance id, searched in all the regions
+- gcp: [[project/]zone/]id, the id can be the instance name too
+- k8s: namespace/name, a pod name in the configured namespace or a pod UID
+- consul: the node id or the node name
+- macstadium: the server id
+
+With --offline the instance is taken from the index of honey sync, and
+with --from-snapshot from the snapshot file.
+
+The output is json including the raw instance unless --output is set.`,
+	RunE: func(command *cobra.Command, args []string) error {
+		CheckArgs(2, 2, command, args)
+
+		ctx := context.TODO()
+		ci := place.GetConfig(ctx)
+
+		defer operations.CacheDB.Close()
+
+		instance, err := operations.Get(ctx, args[0], args[1])
+		if err != nil {
+			return err
+		}
+
+		data := place.Printable{instance}
+
+		format := ci.OutFormat
+		if f := command.Flag("output"); f == nil || !f.Changed {
+			format = "json=" + strings.Join(append(data.Headers(), "raw"), ",")
+		}
+
+		return printers.Print(&printers.PrintInput{
+			Data:      data,
+			Format:    format,
+			NoColor:   ci.NoColor,
+			NoHeaders: ci.NoHeaders,
+		})
+	},
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/bringg/honey/pkg/place/operations"
+)
+
+var (
+	// staleRefreshes are the stale cache entries served, they are
+	// refreshed by a detached process once honey is done
+	staleRefreshes   []*operations.Refresh
+	staleRefreshesMu sync.Mutex
+
+	// refreshSkipFlags are the global flags not passed to the refresh
+	refreshSkipFlags = map[string]struct{}{
+		"filter":  {},
+		"output":  {},
+		"verbose": {},
+		"quiet":   {},
+		// the password is passed in the environment
+		"cache-encrypt": {},
+	}
+
+	cacheRefreshCommand = &cobra.Command{
+		Use:   "refresh <backend> <search> [<backend> <search>]...",
+		Short: `Search the backends again and store the results in the cache.`,
+		Long: `Search the backends again, bypassing the cache, and store the results.
+The search is the match mode and the query of a cache entry, e.g.
+
+    honey cache refresh aws 'substring:api status=running'
+
+honey runs it in the background to refresh the stale entries it served,
+see --stale-ttl.`,
+		RunE: func(command *cobra.Command, args []string) error {
+			CheckArgs(2, 256, command, args)
+			if len(args)%2 != 0 {
+				return errors.New("every backend needs a search")
+			}
+
+			defer operations.CacheDB.Close()
+
+			var (
+				wg       sync.WaitGroup
+				mu       sync.Mutex
+				firstErr error
+			)
+
+			for n := 0; n < len(args); n += 2 {
+				wg.Add(1)
+
+				go func(r *operations.Refresh) {
+					defer wg.Done()
+
+					if err := operations.RefreshCache(context.Background(), r); err != nil {
+						mu.Lock()
+						if firstErr == nil {
+							firstErr = err
+						}
+						mu.Unlock()
+					}
+				}(&operations.Refresh{Backend: args[n], Search: args[n+1]})
+			}
+
+			wg.Wait()
+
+			return firstErr
+		},
+	}
+)
+
+// deferRefreshes keeps the stale cache entries served to refresh them
+// once honey is done, the process doesn't live long enough to refresh
+// them in the background
+func deferRefreshes() {
+	operations.OnStale = func(ctx context.Context, r *operations.Refresh) {
+		staleRefreshesMu.Lock()
+		defer staleRefreshesMu.Unlock()
+
+		staleRefreshes = append(staleRefreshes, r)
+	}
+}
+
+// detachRefreshes starts a detached honey cache refresh of the stale
+// entries, it must run once the cache is closed
+func detachRefreshes() {
+	staleRefreshesMu.Lock()
+	defer staleRefreshesMu.Unlock()
+
+	if len(staleRefreshes) == 0 {
+		return
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		log.Debugf("can't refresh the stale cache: %v", err)
+
+		return
+	}
+
+	args := []string{"cache", "refresh"}
+	for _, r := range staleRefreshes {
+		args = append(args, r.Backend, r.Search)
+	}
+
+	// the backends are configured the same way
+	pflag.CommandLine.VisitAll(func(f *pflag.Flag) {
+		if _, skip := refreshSkipFlags[f.Name]; f.Changed && !skip {
+			args = append(args, "--"+f.Name+"="+f.Value.String())
+		}
+	})
+
+	cmd := exec.Command(exe, args...)
+	detach(cmd)
+
+	if err := cmd.Start(); err != nil {
+		log.Debugf("can't refresh the stale cache: %v", err)
+
+		return
+	}
+
+	_ = cmd.Process.Release()
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -25,6 +26,10 @@ import (
 	"github.com/bringg/honey/pkg/place/printers"
 )
 
+// exitCodePartialResults is the exit code used when some of the
+// backends failed and only partial results were printed
+const exitCodePartialResults = 3
+
 const bannerTmp = `
 88 Build by: %s
 88
@@ -45,19 +50,24 @@ var (
 	version      = "development"
 	commit       = "development"
 	builtBy      = "shareed2k"
-	filter       = ""
+	filters      []string
 	date         = time.Now().String()
 	banner       = fmt.Sprintf(color.GreenString(bannerTmp)+"\n", builtBy, version, commit, date)
 	backendFlags map[string]struct{}
 	// to filter the flags with
 	flagsRe *regexp.Regexp
 
+	// errPartialResults is returned when some of the backends failed
+	errPartialResults = errors.New("some backends failed, results are partial")
+
 	Root = &cobra.Command{
 		Use:           "honey",
 		SilenceUsage:  true,
 		SilenceErrors: true,
 		Short:         "DevOps tool to help find an instance in sea of clouds",
 		Version:       version,
+		// positional args are patterns, not sub commands
+		Args: cobra.ArbitraryArgs,
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 			// Setup shell completion for the k8s-namespace flag
 			if err := cmd.RegisterFlagCompletionFunc("k8s-namespace", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
@@ -112,15 +122,10 @@ var (
 			})
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if len(args) > 0 {
-				re, err := regexp.Compile(args[0])
-				if err != nil {
-					return errors.Wrap(err, "Failed to compile flags regexp")
-				}
-
-				flagsRe = re
-				filter = args[0]
-			}
+			// every filter and positional arg is a pattern, they are ORed
+			patterns := make([]string, 0, len(filters)+len(args))
+			patterns = append(patterns, filters...)
+			patterns = append(patterns, args...)
 
 			ctx := context.TODO()
 			ci := place.GetConfig(ctx)
@@ -130,22 +135,61 @@ var (
 				return err
 			}
 
+			// a snapshot is searched for all its backends
+			if len(backends) == 0 && ci.FromSnapshot != "" {
+				if backends, err = operations.SnapshotBackends(ci.FromSnapshot); err != nil {
+					return err
+				}
+			}
+
 			if len(backends) == 0 {
 				return errors.New("oops you must specify at least one backend")
 			}
 
+			// the refresh must wait for the cache to be closed
+			deferRefreshes()
+			defer detachRefreshes()
 			defer operations.CacheDB.Close()
 
-			instances, err := operations.Find(context.TODO(), backends, filter)
+			printer := printers.NewStreamPrinter(&printers.PrintInput{
+				Format:    ci.OutFormat,
+				NoColor:   ci.NoColor,
+				NoHeaders: ci.NoHeaders,
+				GroupBy:   ci.GroupBy,
+			})
+
+			// print the pages while the slower backends are still searched
+			pages := make(chan place.Printable)
+			printed := make(chan struct{})
+			go func() {
+				defer close(printed)
+
+				for page := range pages {
+					printer.Page(page)
+				}
+			}()
+
+			res, err := operations.FindStream(context.TODO(), backends, patterns, pages)
+			<-printed
 			if err != nil {
 				return err
 			}
 
-			return printers.Print(&printers.PrintInput{
-				Data:    instances,
-				Format:  ci.OutFormat,
-				NoColor: ci.NoColor,
-			})
+			if err := printer.Close(res.Instances); err != nil {
+				return err
+			}
+
+			if strings.HasPrefix(ci.OutFormat, "table") {
+				printAges(res.Ages)
+			}
+
+			if len(res.Errors) > 0 {
+				printWarnings(res.Errors, ci.NoColor)
+
+				return errPartialResults
+			}
+
+			return nil
 		},
 	}
 
@@ -211,10 +255,51 @@ func Execute() {
 	addBackendFlags()
 
 	if err := Root.Execute(); err != nil {
+		if errors.Is(err, errPartialResults) {
+			os.Exit(exitCodePartialResults)
+		}
+
 		log.Fatal(err)
 	}
 }
 
+// printWarnings prints the errors of the failed backends to stderr
+func printWarnings(errs operations.BackendErrors, noColor bool) {
+	warn := color.New(color.FgYellow)
+	if noColor {
+		warn.DisableColor()
+	}
+
+	fmt.Fprintln(os.Stderr)
+	for _, e := range errs {
+		warn.Fprintf(os.Stderr, "WARNING: backend %s: %v\n", e.Backend, e.Err)
+	}
+}
+
+// printAges prints the age of the data of every backend under the
+// table, if some of it was cached
+func printAges(ages map[string]*operations.DataAge) {
+	names := make([]string, 0, len(ages))
+	cached := false
+	for name, age := range ages {
+		names = append(names, name)
+		cached = cached || age.Cached
+	}
+
+	if !cached {
+		return
+	}
+
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for n, name := range names {
+		parts[n] = fmt.Sprintf("%s: %s", name, ages[name])
+	}
+
+	fmt.Printf("data age: %s\n", strings.Join(parts, ", "))
+}
+
 func init() {
 	cobra.OnInitialize(initConfig)
 
@@ -226,6 +311,12 @@ func init() {
 	Root.AddCommand(configCommand)
 	Root.AddCommand(obscureCmd)
 	Root.AddCommand(serveCmd)
+	Root.AddCommand(getCmd)
+	Root.AddCommand(watchCmd)
+	Root.AddCommand(cacheCommand)
+	Root.AddCommand(syncCmd)
+	Root.AddCommand(snapshotCommand)
+	Root.AddCommand(diffCmd)
 
 	helpCommand.AddCommand(helpFlags)
 	helpCommand.AddCommand(helpBackends)
@@ -237,6 +328,9 @@ func init() {
 func initConfig() {
 	// Finish parsing any command line flags
 	configflags.SetFlags()
+
+	// Open the cache once its flags are known
+	openStores(place.GetConfig(context.Background()))
 }
 
 // addBackendFlags creates flags for all the backend options
@@ -357,7 +451,7 @@ func setupRootCommand() {
 	ci := place.GetConfig(context.Background())
 	configflags.AddFlags(ci, pflag.CommandLine)
 
-	flags.StringVarP(pflag.CommandLine, &filter, "filter", "f", "", "instance name filter")
+	flags.StringArrayVarP(pflag.CommandLine, &filters, "filter", "f", nil, "instance name filter, repeat to search several at once")
 
 	cobra.AddTemplateFunc("showLocalFlags", func(cmd *cobra.Command) bool {
 		// Don't show local flags (which are the global ones on the root) on "honey" and
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/bringg/honey/pkg/config"
+	"github.com/bringg/honey/pkg/place"
+	"github.com/bringg/honey/pkg/place/operations"
+)
+
+// snapshotBackend is a backend of honey snapshot save
+type snapshotBackend struct {
+	Backend   string    `json:"backend"`
+	Type      string    `json:"type"`
+	Instances int       `json:"instances"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+var (
+	snapshotCommand = &cobra.Command{
+		Use:   "snapshot",
+		Short: "Save the results of a search to a portable file",
+	}
+
+	snapshotSaveCommand = &cobra.Command{
+		Use:   "save <file> [pattern]...",
+		Short: "Save the instances found to a snapshot file",
+		Long: `Save searches the backends set with --backends, every backend of the
+config file if unset, and writes all the instances found, with their
+raw data, to the file. The patterns are the --filter and the args
+after the file, with --offline the index of honey sync is searched.
+
+Without patterns every instance of the index of honey sync is saved,
+or of the snapshot of --from-snapshot.
+
+The file is searched without the backends or their credentials with
+--from-snapshot, e.g.
+
+    honey -f api --from-snapshot prod.honey`,
+		RunE: func(command *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				CheckArgs(1, 1, command, args)
+			}
+
+			ctx := context.TODO()
+			ci := place.GetConfig(ctx)
+
+			backends, err := ci.Backends()
+			if err != nil {
+				return err
+			}
+
+			if len(backends) == 0 {
+				backends, err = snapshotBackends(ci)
+				if err != nil {
+					return err
+				}
+			}
+
+			if len(backends) == 0 {
+				return errors.New("no backend to snapshot, configure one or set --backends")
+			}
+
+			patterns := make([]string, 0, len(filters)+len(args)-1)
+			patterns = append(patterns, filters...)
+			patterns = append(patterns, args[1:]...)
+
+			if ci.Merge != "" {
+				return errors.New("--merge can't be saved to a snapshot, use it when searching the snapshot")
+			}
+
+			defer operations.CacheDB.Close()
+
+			var res *operations.Result
+			if len(patterns) > 0 {
+				res, err = operations.Find(ctx, backends, patterns)
+			} else {
+				res, err = operations.Indexed(ctx, backends)
+			}
+
+			if err != nil {
+				return err
+			}
+
+			snapshot, err := operations.NewSnapshot(ctx, res, patterns)
+			if err != nil {
+				return err
+			}
+
+			if err := operations.WriteSnapshot(args[0], snapshot); err != nil {
+				return err
+			}
+
+			counts := make(map[string]int, len(snapshot.Backends))
+			for _, i := range res.Instances {
+				counts[i.BackendName]++
+			}
+
+			data := make([]*snapshotBackend, len(snapshot.Backends))
+			rows := make([][]string, len(snapshot.Backends))
+			for n, b := range snapshot.Backends {
+				data[n] = &snapshotBackend{
+					Backend:   b.Name,
+					Type:      b.Type,
+					Instances: counts[b.Name],
+					FetchedAt: b.FetchedAt,
+				}
+
+				rows[n] = []string{b.Name, b.Type, strconv.Itoa(counts[b.Name]), b.FetchedAt.Format(time.RFC3339)}
+			}
+
+			if err := printCache(data, []string{"backend", "type", "instances", "fetched"}, rows); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(os.Stderr, "saved %d instances to %s\n", len(res.Instances), args[0])
+
+			if len(res.Errors) > 0 {
+				printWarnings(res.Errors, ci.NoColor)
+
+				return errPartialResults
+			}
+
+			return nil
+		},
+	}
+)
+
+// snapshotBackends returns the backends searched when --backends is
+// unset, those of --from-snapshot or of the config file
+func snapshotBackends(ci *place.ConfigInfo) ([]string, error) {
+	if ci.FromSnapshot != "" {
+		return operations.SnapshotBackends(ci.FromSnapshot)
+	}
+
+	return config.FileSections(), nil
+}
+
+func init() {
+	snapshotCommand.AddCommand(snapshotSaveCommand)
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/spf13/cobra"
+
+	"github.com/bringg/honey/pkg/config"
+	"github.com/bringg/honey/pkg/place"
+	"github.com/bringg/honey/pkg/place/operations"
+)
+
+// syncResult is a backend of honey sync
+type syncResult struct {
+	Backend   string    `json:"backend"`
+	Status    string    `json:"status"`
+	Instances int       `json:"instances"`
+	SyncedAt  time.Time `json:"synced_at"`
+	Error     string    `json:"error,omitempty"`
+}
+
+var (
+	syncForce bool
+
+	syncCmd = &cobra.Command{
+		Use:   "sync",
+		Short: "Index every instance of the backends locally, for --offline",
+		Long: `Sync lists all the instances of the backends set with --backends, of
+every backend of the config file if unset, into a local index. The
+searches with --offline are answered from the index only, and the
+other ones use it instead of the backend while it is newer than the
+--cache-ttl.
+
+A backend synced within its sync interval, the sync_interval option of
+its section or --sync-interval, is skipped unless --force is set.`,
+		RunE: func(command *cobra.Command, args []string) error {
+			CheckArgs(0, 0, command, args)
+
+			ctx := context.TODO()
+			ci := place.GetConfig(ctx)
+
+			backends, err := ci.Backends()
+			if err != nil {
+				return err
+			}
+
+			if len(backends) == 0 {
+				backends = config.FileSections()
+			}
+
+			if len(backends) == 0 {
+				return errors.New("no backend to sync, configure one or set --backends")
+			}
+
+			defer operations.CacheDB.Close()
+
+			results, err := operations.Sync(ctx, backends, syncForce)
+			if err != nil {
+				return err
+			}
+
+			data := make([]*syncResult, len(results))
+			rows := make([][]string, len(results))
+			var errs operations.BackendErrors
+			for n, r := range results {
+				data[n] = &syncResult{
+					Backend:   r.Backend,
+					Status:    "synced",
+					Instances: r.Instances,
+					SyncedAt:  r.SyncedAt,
+				}
+
+				switch {
+				case r.Err != nil:
+					data[n].Status, data[n].Error = "failed", r.Err.Err.Error()
+					errs = append(errs, r.Err)
+				case r.Skipped:
+					data[n].Status = "skipped"
+				}
+
+				age := ""
+				if !r.SyncedAt.IsZero() {
+					age = time.Since(r.SyncedAt).Round(time.Second).String() + " ago"
+				}
+
+				rows[n] = []string{r.Backend, data[n].Status, strconv.Itoa(r.Instances), age}
+			}
+
+			if err := printCache(data, []string{"backend", "status", "instances", "synced"}, rows); err != nil {
+				return err
+			}
+
+			if len(errs) > 0 {
+				printWarnings(errs, ci.NoColor)
+
+				return errPartialResults
+			}
+
+			return nil
+		},
+	}
+)
+
+func init() {
+	flags.BoolVarP(syncCmd.Flags(), &syncForce, "force", "", false, "sync the backends synced within their sync interval too")
+}
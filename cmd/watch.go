@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/spf13/cobra"
+
+	"github.com/bringg/honey/pkg/place"
+	"github.com/bringg/honey/pkg/place/operations"
+	"github.com/bringg/honey/pkg/place/printers"
+)
+
+var (
+	watchInterval time.Duration
+
+	watchCmd = &cobra.Command{
+		Use:   "watch [pattern...]",
+		Short: "Search the backends periodically and show what changed",
+		Long: `Watch searches the backends every --interval, bypassing the cache, and
+shows the instances which were added or removed and the ones whose
+status or ip addresses changed since the previous search.
+
+On a terminal the table is redrawn on every search with the changes
+highlighted. Otherwise, or with -o ndjson[=keys], a json line is printed
+per change, e.g.
+
+{"time":"...","event":"changed","instance":{...},"changes":{"status":{"from":"pending","to":"running"}}}
+
+The events are added, removed and changed, all the instances of the
+first search are added.`,
+		RunE: func(command *cobra.Command, args []string) error {
+			if watchInterval <= 0 {
+				return errors.New("--interval must be positive")
+			}
+
+			patterns := make([]string, 0, len(filters)+len(args))
+			patterns = append(patterns, filters...)
+			patterns = append(patterns, args...)
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			ci := place.GetConfig(ctx)
+
+			backends, err := ci.Backends()
+			if err != nil {
+				return err
+			}
+
+			if len(backends) == 0 {
+				return errors.New("oops you must specify at least one backend")
+			}
+
+			defer operations.CacheDB.Close()
+
+			title := fmt.Sprintf("Every %s: honey watch %s", watchInterval, strings.Join(patterns, " "))
+			printer := printers.NewWatchPrinter(&printers.PrintInput{
+				Format:  ci.OutFormat,
+				NoColor: ci.NoColor,
+			}, title)
+
+			return operations.Watch(ctx, backends, patterns, watchInterval, func(ev *operations.WatchEvent) error {
+				if err := printer.Print(ev.Time, ev.Result.Instances, ev.Changes, ev.First); err != nil {
+					return err
+				}
+
+				if len(ev.Result.Errors) > 0 {
+					printWarnings(ev.Result.Errors, ci.NoColor)
+				}
+
+				return nil
+			})
+		},
+	}
+)
+
+func init() {
+	flags.DurationVarP(watchCmd.Flags(), &watchInterval, "interval", "", 5*time.Second, "time between the searches")
+}
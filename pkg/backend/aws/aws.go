@@ -3,14 +3,18 @@ package aws
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
 	"github.com/pkg/errors"
 	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/rclone/rclone/fs/config/configstruct"
@@ -18,6 +22,7 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/bringg/honey/pkg/place"
+	"github.com/bringg/honey/pkg/place/query"
 )
 
 const Name = "aws"
@@ -36,11 +41,6 @@ type (
 	Options struct {
 		Region string `config:"region"`
 	}
-
-	ConcurrentSlice struct {
-		sync.RWMutex
-		Items []*place.Instance
-	}
 )
 
 // Register with Backend
@@ -58,13 +58,6 @@ func init() {
 	})
 }
 
-func (cs *ConcurrentSlice) Append(item *place.Instance) {
-	cs.Lock()
-	defer cs.Unlock()
-
-	cs.Items = append(cs.Items, item)
-}
-
 // NewBackend _
 func NewBackend(ctx context.Context, m configmap.Mapper) (place.Backend, error) {
 	// Parse config into Options struct
@@ -83,9 +76,12 @@ func NewBackend(ctx context.Context, m configmap.Mapper) (place.Backend, error)
 
 	if opt.Region == "" {
 		// get list of regions
-		out, err := ec2.NewFromConfig(cfg.Copy()).
-			DescribeRegions(ctx, &ec2.DescribeRegionsInput{})
-		if err != nil {
+		var out *ec2.DescribeRegionsOutput
+		if err := place.Call(ctx, isThrottled, func() (err error) {
+			out, err = ec2.NewFromConfig(cfg.Copy()).
+				DescribeRegions(ctx, &ec2.DescribeRegionsInput{})
+			return err
+		}); err != nil {
 			return nil, err
 		}
 
@@ -126,72 +122,419 @@ func (b *Backend) CacheKeyName(pattern string) string {
 }
 
 func (b *Backend) List(ctx context.Context, backendName string, pattern string) (place.Printable, error) {
-	input := &ec2.DescribeInstancesInput{
-		Filters: []types.Filter{
-			{
-				Name:   aws.String("tag:Name"),
-				Values: []string{fmt.Sprintf("*%s*", pattern)},
-			},
-		},
+	return b.ListQuery(ctx, backendName, &query.Query{Pattern: pattern})
+}
+
+// ListQuery pushes the query terms down as EC2 filters
+func (b *Backend) ListQuery(ctx context.Context, backendName string, q *query.Query) (place.Printable, error) {
+	return place.Collect(func(out chan<- place.Printable) error {
+		return b.Stream(ctx, backendName, q, out)
+	})
+}
+
+// Stream sends the instances of every region as the pages arrive,
+// searching 20+ regions is as slow as the slowest one
+func (b *Backend) Stream(ctx context.Context, backendName string, q *query.Query, out chan<- place.Printable) error {
+	ms, err := place.PatternMatchers(ctx, q)
+	if err != nil {
+		return err
+	}
+
+	searches := patternsFilters(ms)
+	for i, filters := range searches {
+		searches[i] = append(filters, termsFilters(q.Terms, filters)...)
+	}
+
+	return b.stream(ctx, backendName, searches, ms, len(q.Patterns) > 0, out)
+}
+
+// Get describes the instance by id, in all the regions at once
+func (b *Backend) Get(ctx context.Context, backendName string, id string) (*place.Instance, error) {
+	var (
+		mu    sync.Mutex
+		found *place.Instance
+	)
+
+	g, fCtx := errgroup.WithContext(ctx)
+
+	for region, c := range b.cls {
+		g.Go(func(region string, c *ec2.Client) func() error {
+			return func() error {
+				var result *ec2.DescribeInstancesOutput
+				if err := place.Call(fCtx, isThrottled, func() (err error) {
+					result, err = c.DescribeInstances(fCtx, &ec2.DescribeInstancesInput{
+						InstanceIds: []string{id},
+					})
+					return err
+				}); err != nil {
+					if isNotFound(err) {
+						return nil
+					}
+
+					return err
+				}
+
+				for _, r := range result.Reservations {
+					for _, instance := range r.Instances {
+						mu.Lock()
+						found = newInstance(backendName, region, r, instance)
+						mu.Unlock()
+					}
+				}
+
+				return nil
+			}
+		}(region, c))
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	if found == nil {
+		return nil, place.ErrInstanceNotFound
 	}
 
-	if strings.HasPrefix(pattern, "i-") {
-		input.Filters = []types.Filter{
+	return found, nil
+}
+
+// patternFilters returns the filters of the free text pattern, it
+// matches either the instance id, the private or public ip address or
+// the Name tag. EC2 filters are ANDed, so a search for any of the ip
+// addresses is made of a filters set per address, the results of all
+// the sets are merged.
+func patternFilters(m *query.Matcher) [][]types.Filter {
+	pattern := m.Pattern
+	if pattern == "" {
+		return [][]types.Filter{nil}
+	}
+
+	if network := query.ParseNetwork(pattern); network != nil {
+		value := ipFilterValue(network)
+		if network.IP.To4() == nil {
+			return [][]types.Filter{
+				{{Name: aws.String("network-interface.ipv6-addresses.ipv6-address"), Values: []string{value}}},
+			}
+		}
+
+		return [][]types.Filter{
+			{{Name: aws.String("network-interface.addresses.private-ip-address"), Values: []string{value}}},
+			{{Name: aws.String("network-interface.addresses.association.public-ip"), Values: []string{value}}},
+		}
+	}
+
+	if isInstanceID(pattern) {
+		return [][]types.Filter{{
 			{
 				Name:   aws.String("instance-id"),
 				Values: []string{pattern},
 			},
+		}}
+	}
+
+	// wildcards are case sensitive, other patterns are matched by
+	// matchPattern on all the instances
+	glob, ok := m.Glob()
+	if !ok {
+		return [][]types.Filter{nil}
+	}
+
+	return [][]types.Filter{{
+		{
+			Name:   aws.String("tag:Name"),
+			Values: []string{glob},
+		},
+	}}
+}
+
+// globEscaper escapes the wildcards of a tag filter value
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`)
+
+// isCaseless returns true if the value matches the same with and
+// without case sensitivity
+func isCaseless(value string) bool {
+	return strings.ToLower(value) == strings.ToUpper(value)
+}
+
+// patternsFilters returns the filters sets of the patterns, the results
+// of all the sets are merged. The sets of a single filter are merged
+// into one filter of all their values, which EC2 ORs, e.g. the Name tag
+// globs of all the patterns.
+func patternsFilters(ms []*query.Matcher) [][]types.Filter {
+	searches := make([][]types.Filter, 0)
+	merged := make(map[string]*types.Filter)
+	for _, m := range ms {
+		for _, filters := range patternFilters(m) {
+			switch len(filters) {
+			case 0:
+				// the pattern can't be filtered, all the instances are
+				// listed anyway
+				return [][]types.Filter{nil}
+			case 1:
+				name := aws.ToString(filters[0].Name)
+				if f, ok := merged[name]; ok {
+					f.Values = append(f.Values, filters[0].Values...)
+
+					continue
+				}
+
+				// the filter of the set is the merged one
+				merged[name] = &filters[0]
+				searches = append(searches, filters)
+			default:
+				searches = append(searches, filters)
+			}
+		}
+	}
+
+	return searches
+}
+
+func isInstanceID(pattern string) bool {
+	return strings.HasPrefix(pattern, "i-")
+}
+
+// ipFilterValue returns the filter value of the network, filters
+// don't support CIDR so the network is widened to the closest wildcard
+// and the results are matched by matchPattern
+func ipFilterValue(network *net.IPNet) string {
+	if query.IsSingleIP(network) {
+		return network.IP.String()
+	}
+
+	ip := network.IP.To4()
+	if ip == nil {
+		return "*"
+	}
+
+	ones, _ := network.Mask.Size()
+
+	octets := make([]string, 0, ones/8+1)
+	for i := 0; i < ones/8; i++ {
+		octets = append(octets, strconv.Itoa(int(ip[i])))
+	}
+
+	return strings.Join(append(octets, "*"), ".")
+}
+
+// matchPatterns returns the instances which match any of the
+// patterns, the filters may have been wider than them. The instances
+// are tagged with the patterns they match if tag is set.
+func matchPatterns(ins place.Printable, ms []*query.Matcher, tag bool) place.Printable {
+	matched := make(place.Printable, 0, len(ins))
+	for _, i := range ins {
+		patterns := place.MatchedPatterns(ms, func(m *query.Matcher) bool {
+			return matchPattern(i, m)
+		})
+		if len(patterns) == 0 {
+			continue
+		}
+
+		if tag {
+			i.Patterns = patterns
+		}
+
+		matched = append(matched, i)
+	}
+
+	return matched
+}
+
+// matchPattern returns true if the instance id, one of its ip addresses
+// or its Name tag matches the pattern
+func matchPattern(i *place.Instance, m *query.Matcher) bool {
+	if m.Pattern == "" {
+		return true
+	}
+
+	if isInstanceID(m.Pattern) {
+		return i.ID == m.Pattern
+	}
+
+	if network := query.ParseNetwork(m.Pattern); network != nil {
+		return query.NetworkContains(network, addresses(i)...)
+	}
+
+	return m.Match(i.Labels["Name"])
+}
+
+// addresses returns all the ip addresses of the instance network interfaces
+func addresses(i *place.Instance) []string {
+	ips := []string{i.PrivateIP, i.PublicIP}
+
+	instance, ok := i.Raw.(types.Instance)
+	if !ok {
+		return ips
+	}
+
+	ips = append(ips, aws.ToString(instance.Ipv6Address))
+	for _, ni := range instance.NetworkInterfaces {
+		for _, addr := range ni.PrivateIpAddresses {
+			ips = append(ips, aws.ToString(addr.PrivateIpAddress))
+			if addr.Association != nil {
+				ips = append(ips, aws.ToString(addr.Association.PublicIp))
+			}
+		}
+
+		for _, addr := range ni.Ipv6Addresses {
+			ips = append(ips, aws.ToString(addr.Ipv6Address))
 		}
 	}
 
-	instances := new(ConcurrentSlice)
+	return ips
+}
+
+// termsFilters returns the filters for the terms EC2 can evaluate,
+// filters only support positive conditions, negative terms and the
+// rest are left to the caller. A filter name is used only once. Tag
+// filters are case sensitive while terms aren't, so the Name tag is
+// filtered only by values without letters of either case.
+func termsFilters(terms query.Terms, existing []types.Filter) []types.Filter {
+	used := make(map[string]struct{})
+	for _, f := range existing {
+		used[aws.ToString(f.Name)] = struct{}{}
+	}
+
+	filters := make([]types.Filter, 0)
+	for _, t := range terms {
+		if t.Negative() {
+			continue
+		}
+
+		var name, value string
+		switch {
+		case t.Field == query.FieldName && !isCaseless(t.Value):
+			continue
+		case t.Field == query.FieldName && t.Op == query.OpMatch:
+			name, value = "tag:Name", fmt.Sprintf("*%s*", globEscaper.Replace(t.Value))
+		case t.Field == query.FieldName:
+			name, value = "tag:Name", globEscaper.Replace(t.Value)
+		case t.Op != query.OpEqual:
+			continue
+		case t.Field == query.FieldID:
+			name, value = "instance-id", t.Value
+		case t.Field == query.FieldStatus:
+			name, value = "instance-state-name", strings.ToLower(t.Value)
+		case t.Field == query.FieldType:
+			name, value = "instance-type", strings.ToLower(t.Value)
+		case t.Field == query.FieldPrivateIP && t.IsIP():
+			name, value = "private-ip-address", t.Value
+		case t.Field == query.FieldPublicIP && t.IsIP():
+			name, value = "ip-address", t.Value
+		default:
+			continue
+		}
+
+		if _, ok := used[name]; ok {
+			continue
+		}
 
+		used[name] = struct{}{}
+		filters = append(filters, types.Filter{
+			Name:   aws.String(name),
+			Values: []string{value},
+		})
+	}
+
+	return filters
+}
+
+// stream runs the searches in all the regions, an instance found by
+// more than one search is sent once
+func (b *Backend) stream(ctx context.Context, backendName string, searches [][]types.Filter, ms []*query.Matcher, tag bool, out chan<- place.Printable) error {
 	g, fCtx := errgroup.WithContext(ctx)
 
 	for region, c := range b.cls {
 		log.Debugf("using region %s", region)
 
-		g.Go(func(c *ec2.Client) func() error {
+		g.Go(func(region string, c *ec2.Client) func() error {
 			return func() error {
-				result, err := c.DescribeInstances(fCtx, input)
-				if err != nil {
-					return err
-				}
+				seen := make(map[string]struct{})
+				for _, filters := range searches {
+					pages := ec2.NewDescribeInstancesPaginator(c, &ec2.DescribeInstancesInput{
+						Filters: filters,
+					})
+
+					for pages.HasMorePages() {
+						var result *ec2.DescribeInstancesOutput
+						if err := place.Call(fCtx, isThrottled, func() (err error) {
+							result, err = pages.NextPage(fCtx)
+							return err
+						}); err != nil {
+							return err
+						}
 
-				for _, r := range result.Reservations {
-					for _, instance := range r.Instances {
-						// We need to see if the Name is one of the tags. It's not always
-						// present and not required in Ec2.
-						name := "None"
-						for _, t := range instance.Tags {
-							if *t.Key == "Name" {
-								name = url.QueryEscape(*t.Value)
+						page := make(place.Printable, 0)
+						for _, r := range result.Reservations {
+							for _, instance := range r.Instances {
+								if _, ok := seen[aws.ToString(instance.InstanceId)]; ok {
+									continue
+								}
+
+								seen[aws.ToString(instance.InstanceId)] = struct{}{}
+								page = append(page, newInstance(backendName, region, r, instance))
 							}
 						}
 
-						instances.Append(&place.Instance{
-							Model: place.Model{
-								BackendName: backendName,
-								ID:          aws.ToString(instance.InstanceId),
-								Name:        name,
-								Type:        string(instance.InstanceType),
-								Status:      aws.ToString((*string)(&instance.State.Name)),
-								PrivateIP:   aws.ToString(instance.PrivateIpAddress),
-								PublicIP:    aws.ToString(instance.PublicIpAddress),
-							},
-							Raw: instance,
-						})
+						if err := place.SendPage(fCtx, out, matchPatterns(page, ms, tag)); err != nil {
+							return err
+						}
 					}
 				}
 
 				return nil
 			}
-		}(c))
+		}(region, c))
 	}
 
-	if err := g.Wait(); err != nil {
-		return nil, err
+	return g.Wait()
+}
+
+// isNotFound returns true if the instance id doesn't exist in the region
+func isNotFound(err error) bool {
+	var apiErr smithy.APIError
+
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidInstanceID.NotFound"
+}
+
+// isThrottled returns true if EC2 throttled the request
+func isThrottled(err error) bool {
+	return retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err) == aws.TrueTernary
+}
+
+func newInstance(backendName, region string, r types.Reservation, instance types.Instance) *place.Instance {
+	// We need to see if the Name is one of the tags. It's not always
+	// present and not required in Ec2.
+	name := "None"
+	labels := make(map[string]string, len(instance.Tags))
+	for _, t := range instance.Tags {
+		if *t.Key == "Name" {
+			name = url.QueryEscape(*t.Value)
+		}
+
+		labels[aws.ToString(t.Key)] = aws.ToString(t.Value)
 	}
 
-	return instances.Items, nil
+	zone := ""
+	if instance.Placement != nil {
+		zone = aws.ToString(instance.Placement.AvailabilityZone)
+	}
+
+	return &place.Instance{
+		Model: place.Model{
+			BackendName: backendName,
+			ID:          aws.ToString(instance.InstanceId),
+			Name:        name,
+			Type:        string(instance.InstanceType),
+			Status:      aws.ToString((*string)(&instance.State.Name)),
+			PrivateIP:   aws.ToString(instance.PrivateIpAddress),
+			PublicIP:    aws.ToString(instance.PublicIpAddress),
+			Region:      region,
+			Zone:        zone,
+			Account:     aws.ToString(r.OwnerId),
+			CreatedAt:   instance.LaunchTime,
+			Labels:      labels,
+		},
+		Raw: instance,
+	}
 }
@@ -0,0 +1,93 @@
+package aws
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+
+	"github.com/bringg/honey/pkg/place/query"
+)
+
+func TestTermsFilters(t *testing.T) {
+	for _, test := range []struct {
+		query string
+		want  map[string]string
+	}{
+		{query: "name~API", want: map[string]string{}},
+		{query: "name=api-1", want: map[string]string{}},
+		{query: "name~10-", want: map[string]string{"tag:Name": "*10-*"}},
+		{query: "name=10*", want: map[string]string{"tag:Name": `10\*`}},
+		{query: "name!~10 status=Running", want: map[string]string{"instance-state-name": "running"}},
+		{query: "id=i-1 private_ip=10.0.0.1", want: map[string]string{"instance-id": "i-1", "private-ip-address": "10.0.0.1"}},
+	} {
+		q, err := query.Parse(test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := make(map[string]string)
+		for _, f := range termsFilters(q.Terms, nil) {
+			got[aws.ToString(f.Name)] = f.Values[0]
+		}
+
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got filters %v, want %v", test.query, got, test.want)
+
+			continue
+		}
+
+		for name, value := range test.want {
+			if got[name] != value {
+				t.Errorf("%s: %s = %q, want %q", test.query, name, got[name], value)
+			}
+		}
+	}
+}
+
+func TestPatternsFilters(t *testing.T) {
+	matchers := func(patterns ...string) []*query.Matcher {
+		ms := make([]*query.Matcher, len(patterns))
+		for n, p := range patterns {
+			m, err := query.NewMatcher(p, query.MatchSubstring, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ms[n] = m
+		}
+
+		return ms
+	}
+
+	searches := patternsFilters(matchers("api", "worker", "i-123", "10.0.0.1"))
+
+	got := make(map[string][]string)
+	for _, filters := range searches {
+		if len(filters) != 1 {
+			t.Fatalf("got filters set %v, want a single filter", filters)
+		}
+
+		got[aws.ToString(filters[0].Name)] = filters[0].Values
+	}
+
+	for name, want := range map[string][]string{
+		"tag:Name":    {"*api*", "*worker*"},
+		"instance-id": {"i-123"},
+		"network-interface.addresses.private-ip-address":    {"10.0.0.1"},
+		"network-interface.addresses.association.public-ip": {"10.0.0.1"},
+	} {
+		if len(got[name]) != len(want) || strings.Join(got[name], ",") != strings.Join(want, ",") {
+			t.Errorf("%s = %v, want %v", name, got[name], want)
+		}
+	}
+
+	if len(got) != 4 {
+		t.Errorf("got %d searches, want 4", len(got))
+	}
+
+	// a pattern which can't be filtered lists all the instances
+	if searches := patternsFilters(matchers("api", "")); len(searches) != 1 || searches[0] != nil {
+		t.Errorf("got %v, want a single unfiltered search", searches)
+	}
+}
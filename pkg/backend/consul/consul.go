@@ -2,7 +2,12 @@ package consul
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/hashicorp/consul/api"
 	"github.com/rclone/rclone/fs/config/configmap"
@@ -10,6 +15,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/bringg/honey/pkg/place"
+	"github.com/bringg/honey/pkg/place/query"
 )
 
 const Name = "consul"
@@ -187,17 +193,168 @@ func (b *Backend) CacheKeyName(pattern string) string {
 }
 
 func (b *Backend) List(ctx context.Context, backendName string, pattern string) (place.Printable, error) {
-	nodes, _, err := b.client.Catalog().Nodes(&api.QueryOptions{
-		Filter: fmt.Sprintf(`Node contains "%s"`, pattern),
-	})
+	m, err := place.PatternMatcher(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.list(ctx, backendName, patternFilter(m), []*query.Matcher{m}, false)
+}
+
+// ListQuery pushes the query terms down as a catalog filter expression
+func (b *Backend) ListQuery(ctx context.Context, backendName string, q *query.Query) (place.Printable, error) {
+	ms, err := place.PatternMatchers(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	filters := termsFilters(q.Terms)
+	if f := patternsFilter(ms); f != "" {
+		filters = append([]string{f}, filters...)
+	}
+
+	return b.list(ctx, backendName, strings.Join(filters, " and "), ms, len(q.Patterns) > 0)
+}
+
+// Get returns the catalog node by its ID or its name
+func (b *Backend) Get(ctx context.Context, backendName string, id string) (*place.Instance, error) {
+	filter := fmt.Sprintf("ID == %s or Node == %s", strconv.Quote(id), strconv.Quote(id))
+
+	instances, err := b.list(ctx, backendName, filter, nil, false)
 	if err != nil {
 		return nil, err
 	}
 
-	instances := make([]*place.Instance, len(nodes))
-	for i, node := range nodes {
-		hc, _, err := b.client.Health().Node(node.Node, &api.QueryOptions{})
-		if err != nil {
+	if len(instances) == 0 {
+		return nil, place.ErrInstanceNotFound
+	}
+
+	return instances[0], nil
+}
+
+// patternFilter matches the node name with the regexp of the match
+// mode, ip patterns are matched by matchPattern on the node address and
+// tagged addresses
+func patternFilter(m *query.Matcher) string {
+	if m.Pattern == "" || query.ParseNetwork(m.Pattern) != nil {
+		return ""
+	}
+
+	return fmt.Sprintf(`Node matches %s`, strconv.Quote(m.Regexp()))
+}
+
+// termsFilters returns the filter expressions of the terms on the
+// catalog node fields, the node status comes from the health checks
+// so it is left to the caller
+func termsFilters(terms query.Terms) []string {
+	filters := make([]string, 0)
+	for _, t := range terms {
+		var selector string
+		switch {
+		case t.Field == query.FieldName:
+			selector = "Node"
+		case t.Field == query.FieldID:
+			selector = "ID"
+		case t.Field == query.FieldPrivateIP && t.IsIP():
+			selector = "Address"
+		default:
+			continue
+		}
+
+		// names are compared case insensitive like the caller does
+		value := t.Value
+		op := "=="
+		switch {
+		case t.Op == query.OpMatch:
+			op, value = "matches", "(?i)"+regexp.QuoteMeta(t.Value)
+		case t.Op == query.OpNotMatch:
+			op, value = "not matches", "(?i)"+regexp.QuoteMeta(t.Value)
+		case selector == "Node":
+			op, value = "matches", "(?i)^"+regexp.QuoteMeta(t.Value)+"$"
+			if t.Op == query.OpNotEqual {
+				op = "not matches"
+			}
+		case t.Op == query.OpNotEqual:
+			op = "!="
+		}
+
+		filters = append(filters, fmt.Sprintf("%s %s %s", selector, op, strconv.Quote(value)))
+	}
+
+	return filters
+}
+
+// patternsFilter ORs the filters of the patterns, the nodes are listed
+// unfiltered if one of them can't be filtered
+func patternsFilter(ms []*query.Matcher) string {
+	filters := make([]string, 0, len(ms))
+	for _, m := range ms {
+		f := patternFilter(m)
+		if f == "" {
+			return ""
+		}
+
+		filters = append(filters, f)
+	}
+
+	if len(filters) == 1 {
+		return filters[0]
+	}
+
+	return "(" + strings.Join(filters, ") or (") + ")"
+}
+
+// matchPattern returns true if the node name matches the pattern like
+// its filter does, or if the node address or one of its tagged
+// addresses is in the network of an ip pattern
+func matchPattern(node *api.Node, m *query.Matcher) bool {
+	if m.Pattern == "" {
+		return true
+	}
+
+	if network := query.ParseNetwork(m.Pattern); network != nil {
+		ips := []string{node.Address}
+		for _, ip := range node.TaggedAddresses {
+			ips = append(ips, ip)
+		}
+
+		return query.NetworkContains(network, ips...)
+	}
+
+	return m.Match(node.Node)
+}
+
+// list returns the nodes of the filter which match any of the patterns,
+// all of them if there are none. The instances are tagged with the
+// patterns they match if tag is set.
+func (b *Backend) list(ctx context.Context, backendName string, filter string, ms []*query.Matcher, tag bool) (place.Printable, error) {
+	q := (&api.QueryOptions{
+		Filter: filter,
+	}).WithContext(ctx)
+
+	var nodes []*api.Node
+	if err := place.Call(ctx, isThrottled, func() (err error) {
+		nodes, _, err = b.client.Catalog().Nodes(q)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	instances := make([]*place.Instance, 0, len(nodes))
+	for _, node := range nodes {
+		// match before the health checks, it costs a request per node
+		patterns := place.MatchedPatterns(ms, func(m *query.Matcher) bool {
+			return matchPattern(node, m)
+		})
+		if len(ms) > 0 && len(patterns) == 0 {
+			continue
+		}
+
+		var hc api.HealthChecks
+		if err := place.Call(ctx, isThrottled, func() (err error) {
+			hc, _, err = b.client.Health().Node(node.Node, (&api.QueryOptions{}).WithContext(ctx))
+			return err
+		}); err != nil {
 			return nil, err
 		}
 
@@ -207,7 +364,7 @@ func (b *Backend) List(ctx context.Context, backendName string, pattern string)
 			publicIP = wan
 		}
 
-		instances[i] = &place.Instance{
+		i := &place.Instance{
 			Model: place.Model{
 				BackendName: backendName,
 				ID:          node.ID,
@@ -216,10 +373,27 @@ func (b *Backend) List(ctx context.Context, backendName string, pattern string)
 				Status:      hc.AggregatedStatus(),
 				PrivateIP:   privateIP,
 				PublicIP:    publicIP,
+				Region:      node.Datacenter,
+				Zone:        node.Meta["zone"],
+				Account:     node.Partition,
+				Labels:      node.Meta,
 			},
 			Raw: node,
 		}
+
+		if tag {
+			i.Patterns = patterns
+		}
+
+		instances = append(instances, i)
 	}
 
 	return instances, nil
 }
+
+// isThrottled returns true if the agent rate limit was exceeded
+func isThrottled(err error) bool {
+	var statusErr api.StatusError
+
+	return errors.As(err, &statusErr) && statusErr.Code == http.StatusTooManyRequests
+}
@@ -4,16 +4,21 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/rclone/rclone/fs/config/configstruct"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
 
 	"github.com/bringg/honey/pkg/place"
+	"github.com/bringg/honey/pkg/place/query"
 )
 
 const Name = "gcp"
@@ -76,55 +81,369 @@ func (b *Backend) CacheKeyName(pattern string) string {
 }
 
 func (b *Backend) List(ctx context.Context, backendName string, pattern string) (place.Printable, error) {
+	return b.ListQuery(ctx, backendName, &query.Query{Pattern: pattern})
+}
+
+// ListQuery pushes the query terms down to the instances list filter
+func (b *Backend) ListQuery(ctx context.Context, backendName string, q *query.Query) (place.Printable, error) {
+	return place.Collect(func(out chan<- place.Printable) error {
+		return b.Stream(ctx, backendName, q, out)
+	})
+}
+
+// Stream sends the instances of every list page as it arrives
+func (b *Backend) Stream(ctx context.Context, backendName string, q *query.Query, out chan<- place.Printable) error {
+	ms, err := place.PatternMatchers(ctx, q)
+	if err != nil {
+		return err
+	}
+
+	return b.stream(ctx, backendName, joinFilters(append(patternsFilter(ms), termsFilters(q.Terms)...)...), ms, len(q.Patterns) > 0, out)
+}
+
+// Get returns the instance by `project/zone/id`, `zone/id` in any of
+// the projects, or by id or name alone. The id can also be the
+// instance name.
+func (b *Backend) Get(ctx context.Context, backendName string, id string) (*place.Instance, error) {
+	parts := strings.Split(id, "/")
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("invalid instance id %q, use [[project/]zone/]id", id)
+	}
+
+	// search the instance by id or name in all the zones
+	if len(parts) == 1 {
+		return b.find(ctx, backendName, id)
+	}
+
+	projects := []string(b.opt.Projects)
+	if len(parts) == 3 {
+		projects = parts[:1]
+	}
+
+	zone, name := parts[len(parts)-2], parts[len(parts)-1]
+
 	computeService, err := compute.NewService(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	instances := make([]*place.Instance, 0)
+	for _, project := range projects {
+		var instance *compute.Instance
+		err := place.Call(ctx, isThrottled, func() (err error) {
+			instance, err = computeService.Instances.Get(project, zone, name).Context(ctx).Do()
+			return err
+		})
+
+		switch {
+		case isNotFound(err):
+			continue
+		case err != nil:
+			return nil, err
+		}
+
+		return newInstance(backendName, project, instance), nil
+	}
+
+	return nil, place.ErrInstanceNotFound
+}
+
+// find lists the instances with the id, or the name, in all the projects
+func (b *Backend) find(ctx context.Context, backendName string, id string) (*place.Instance, error) {
+	filter := fmt.Sprintf("name eq %s", strconv.Quote(regexp.QuoteMeta(id)))
+	if n, err := strconv.ParseUint(id, 10, 64); err == nil {
+		filter = fmt.Sprintf("id eq %d", n)
+	}
+
+	instances, err := place.Collect(func(out chan<- place.Printable) error {
+		return b.stream(ctx, backendName, filter, nil, false, out)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(instances) == 0 {
+		return nil, place.ErrInstanceNotFound
+	}
+
+	return instances[0], nil
+}
+
+// patternFilter matches the instance id if the pattern is numeric and
+// matched exactly, or the instance name with the quoted regexp of the
+// match mode. The filter can't OR the addresses of the network
+// interfaces, nor the id with the name, ip patterns are matched by
+// matchPattern.
+func patternFilter(m *query.Matcher) []string {
+	if m.Pattern == "" || query.ParseNetwork(m.Pattern) != nil {
+		return nil
+	}
+
+	if id, ok := patternID(m); ok {
+		return []string{fmt.Sprintf(`id eq %d`, id)}
+	}
+
+	return []string{fmt.Sprintf(`name eq %s`, strconv.Quote(m.Regexp()))}
+}
+
+// patternsFilter returns the filter of the patterns. The filter syntax
+// can't OR expressions, several patterns are filtered only if they all
+// match the instance name, by the alternation of their regexps.
+func patternsFilter(ms []*query.Matcher) []string {
+	if len(ms) == 1 {
+		return patternFilter(ms[0])
+	}
+
+	exprs := make([]string, 0, len(ms))
+	for _, m := range ms {
+		if _, ok := patternID(m); ok || m.Pattern == "" || query.ParseNetwork(m.Pattern) != nil {
+			return nil
+		}
+
+		exprs = append(exprs, "(?:"+m.Regexp()+")")
+	}
+
+	return []string{fmt.Sprintf(`name eq %s`, strconv.Quote(strings.Join(exprs, "|")))}
+}
+
+// patternID returns the instance id of a numeric pattern matched
+// exactly, numeric patterns of the other match modes, e.g. a substring,
+// are matched against the name
+func patternID(m *query.Matcher) (uint64, bool) {
+	if m.Mode != query.MatchExact {
+		return 0, false
+	}
+
+	id, err := strconv.ParseUint(m.Pattern, 10, 64)
+
+	return id, err == nil && id > 0
+}
+
+// matchPattern returns true if the instance matches the pattern like
+// its filter does, or if one of the addresses of its network interfaces
+// is in the network of an ip pattern
+func matchPattern(instance *compute.Instance, m *query.Matcher) bool {
+	if m.Pattern == "" {
+		return true
+	}
+
+	if network := query.ParseNetwork(m.Pattern); network != nil {
+		ips := make([]string, 0)
+		for _, ni := range instance.NetworkInterfaces {
+			ips = append(ips, ni.NetworkIP, ni.Ipv6Address)
+			for _, ac := range ni.AccessConfigs {
+				ips = append(ips, ac.NatIP, ac.ExternalIpv6)
+			}
+		}
+
+		return query.NetworkContains(network, ips...)
+	}
+
+	if id, ok := patternID(m); ok {
+		return instance.Id == id
+	}
+
+	return m.Match(instance.Name)
+}
+
+// termsFilters returns the RE2 filter expressions of the terms, the
+// expressions are case insensitive like the caller does
+func termsFilters(terms query.Terms) []string {
+	filters := make([]string, 0)
+	for _, t := range terms {
+		value := "(?i)" + regexp.QuoteMeta(t.Value)
+
+		var field string
+		switch {
+		case t.Field == query.FieldName:
+			field = "name"
+			if t.Op == query.OpMatch || t.Op == query.OpNotMatch {
+				value = "(?i).*" + regexp.QuoteMeta(t.Value) + ".*"
+			}
+		case t.Op == query.OpMatch || t.Op == query.OpNotMatch:
+			continue
+		case t.Field == query.FieldStatus:
+			field = "status"
+		case t.Field == query.FieldType:
+			field, value = "machineType", "(?i).*/"+regexp.QuoteMeta(t.Value)
+		case t.Field == query.FieldID:
+			id, err := strconv.ParseUint(t.Value, 10, 64)
+			if err != nil {
+				continue
+			}
+
+			field, value = "id", strconv.FormatUint(id, 10)
+		default:
+			continue
+		}
+
+		// the regexps are quoted, they may have spaces
+		if field != "id" {
+			value = strconv.Quote(value)
+		}
+
+		op := "eq"
+		if t.Negative() {
+			op = "ne"
+		}
+
+		filters = append(filters, fmt.Sprintf("%s %s %s", field, op, value))
+	}
+
+	return filters
+}
+
+// joinFilters joins the expressions, multiple expressions must be
+// parenthesized
+func joinFilters(filters ...string) string {
+	if len(filters) == 1 {
+		return filters[0]
+	}
+
+	parts := make([]string, len(filters))
+	for i, f := range filters {
+		parts[i] = "(" + f + ")"
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// stream sends the instances of the filter which match any of the
+// patterns, all of them if there are none. The instances are tagged
+// with the patterns they match if tag is set.
+func (b *Backend) stream(ctx context.Context, backendName string, filter string, ms []*query.Matcher, tag bool, out chan<- place.Printable) error {
+	computeService, err := compute.NewService(ctx)
+	if err != nil {
+		return err
+	}
+
 	for _, project := range b.opt.Projects {
 		log.Debugf("using project %s", project)
 
 		call := computeService.Instances.AggregatedList(project)
-		call.Filter(fmt.Sprintf(`name eq .*%s.*`, pattern))
-		if id, _ := strconv.ParseInt(pattern, 10, 64); id > 0 {
-			call.Filter(fmt.Sprintf(`id eq %d`, id))
+		if filter != "" {
+			call.Filter(filter)
 		}
 
-		if err := call.Pages(ctx, func(page *compute.InstanceAggregatedList) error {
-			for _, items := range page.Items {
-				for _, instance := range items.Instances {
-					privateIP := ""
-					publicIP := ""
-					if len(instance.NetworkInterfaces) > 0 && instance.NetworkInterfaces[0].NetworkIP != "" {
-						privateIP = instance.NetworkInterfaces[0].NetworkIP
-
-						if len(instance.NetworkInterfaces[0].AccessConfigs) > 0 && instance.NetworkInterfaces[0].AccessConfigs[0].NatIP != "" {
-							publicIP = instance.NetworkInterfaces[0].AccessConfigs[0].NatIP
-						}
-					}
-
-					m := strings.Split(instance.MachineType, "/")
-					instances = append(instances, &place.Instance{
-						Model: place.Model{
-							BackendName: backendName,
-							ID:          strconv.FormatUint(instance.Id, 10),
-							Name:        instance.Name,
-							Type:        m[len(m)-1],
-							Status:      instance.Status,
-							PrivateIP:   privateIP,
-							PublicIP:    publicIP,
-						},
-						Raw: instance,
-					})
-				}
+		for token := ""; ; {
+			var page *compute.InstanceAggregatedList
+			if err := place.Call(ctx, isThrottled, func() (err error) {
+				page, err = call.PageToken(token).Context(ctx).Do()
+				return err
+			}); err != nil {
+				return err
 			}
 
-			return nil
-		}); err != nil {
-			return nil, err
+			if err := place.SendPage(ctx, out, newInstances(backendName, project, page, ms, tag)); err != nil {
+				return err
+			}
+
+			if page.NextPageToken == "" {
+				break
+			}
+
+			token = page.NextPageToken
+		}
+	}
+
+	return nil
+}
+
+// newInstances returns the instances of the list page which match
+func newInstances(backendName, project string, page *compute.InstanceAggregatedList, ms []*query.Matcher, tag bool) place.Printable {
+	instances := make(place.Printable, 0)
+	for _, items := range page.Items {
+		for _, instance := range items.Instances {
+			patterns := place.MatchedPatterns(ms, func(m *query.Matcher) bool {
+				return matchPattern(instance, m)
+			})
+			if len(ms) > 0 && len(patterns) == 0 {
+				continue
+			}
+
+			i := newInstance(backendName, project, instance)
+			if tag {
+				i.Patterns = patterns
+			}
+
+			instances = append(instances, i)
 		}
 	}
 
-	return instances, nil
+	return instances
+}
+
+func newInstance(backendName, project string, instance *compute.Instance) *place.Instance {
+	privateIP := ""
+	publicIP := ""
+	if len(instance.NetworkInterfaces) > 0 && instance.NetworkInterfaces[0].NetworkIP != "" {
+		privateIP = instance.NetworkInterfaces[0].NetworkIP
+
+		if len(instance.NetworkInterfaces[0].AccessConfigs) > 0 && instance.NetworkInterfaces[0].AccessConfigs[0].NatIP != "" {
+			publicIP = instance.NetworkInterfaces[0].AccessConfigs[0].NatIP
+		}
+	}
+
+	var createdAt *time.Time
+	if t, err := time.Parse(time.RFC3339, instance.CreationTimestamp); err == nil {
+		createdAt = &t
+	}
+
+	zone := lastPathPart(instance.Zone)
+	region := zone
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		region = zone[:i]
+	}
+
+	return &place.Instance{
+		Model: place.Model{
+			BackendName: backendName,
+			ID:          strconv.FormatUint(instance.Id, 10),
+			Name:        instance.Name,
+			Type:        lastPathPart(instance.MachineType),
+			Status:      instance.Status,
+			PrivateIP:   privateIP,
+			PublicIP:    publicIP,
+			Region:      region,
+			Zone:        zone,
+			Account:     project,
+			CreatedAt:   createdAt,
+			Labels:      instance.Labels,
+		},
+		Raw: instance,
+	}
+}
+
+// isThrottled returns true if the compute API rate limit was exceeded
+func isThrottled(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	if apiErr.Code == http.StatusTooManyRequests {
+		return true
+	}
+
+	for _, e := range apiErr.Errors {
+		if e.Reason == "rateLimitExceeded" || e.Reason == "userRateLimitExceeded" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isNotFound returns true if the instance doesn't exist
+func isNotFound(err error) bool {
+	var apiErr *googleapi.Error
+
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+// lastPathPart returns the name of a resource from its url, e.g.
+// https://www.googleapis.com/compute/v1/projects/prj/zones/us-east1-d
+func lastPathPart(url string) string {
+	parts := strings.Split(url, "/")
+
+	return parts[len(parts)-1]
 }
@@ -0,0 +1,56 @@
+package gcp
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/api/compute/v1"
+
+	"github.com/bringg/honey/pkg/place/query"
+)
+
+func TestPatternFilter(t *testing.T) {
+	for _, test := range []struct {
+		pattern string
+		mode    query.MatchMode
+		want    string
+	}{
+		{pattern: "my api", mode: query.MatchExact, want: `name eq "(?s)^(?:my api)$"`},
+		{pattern: `web"1`, mode: query.MatchExact, want: `name eq "(?s)^(?:web\"1)$"`},
+		{pattern: "1234", mode: query.MatchExact, want: "id eq 1234"},
+		{pattern: "1234", mode: query.MatchSubstring, want: `name eq "(?s)^(?:.*1234.*)$"`},
+		{pattern: "10.0.0.0/8", mode: query.MatchSubstring, want: ""},
+	} {
+		m, err := query.NewMatcher(test.pattern, test.mode, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := strings.Join(patternFilter(m), " "); got != test.want {
+			t.Errorf("%s %s: got %s, want %s", test.mode, test.pattern, got, test.want)
+		}
+
+	}
+}
+
+func TestMatchNumericPattern(t *testing.T) {
+	for _, test := range []struct {
+		mode     query.MatchMode
+		instance *compute.Instance
+		want     bool
+	}{
+		{mode: query.MatchExact, instance: &compute.Instance{Id: 1234, Name: "web"}, want: true},
+		{mode: query.MatchExact, instance: &compute.Instance{Id: 1, Name: "1234"}, want: false},
+		{mode: query.MatchSubstring, instance: &compute.Instance{Id: 1, Name: "web-1234"}, want: true},
+		{mode: query.MatchSubstring, instance: &compute.Instance{Id: 1234, Name: "web"}, want: false},
+	} {
+		m, err := query.NewMatcher("1234", test.mode, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := matchPattern(test.instance, m); got != test.want {
+			t.Errorf("%s %d/%s: got %v, want %v", test.mode, test.instance.Id, test.instance.Name, got, test.want)
+		}
+	}
+}
@@ -3,20 +3,28 @@ package k8s
 import (
 	"context"
 	"fmt"
-	"regexp"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/rclone/rclone/fs/config/configstruct"
 	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/bringg/honey/pkg/place"
+	"github.com/bringg/honey/pkg/place/query"
 )
 
-const Name = "k8s"
+const (
+	Name = "k8s"
+	// pageSize is the number of pods listed per request
+	pageSize = 500
+)
 
 var (
 	log = logrus.WithField("backend", Name)
@@ -24,8 +32,9 @@ var (
 
 type (
 	Backend struct {
-		client *kubernetes.Clientset
-		opt    Options
+		client  *kubernetes.Clientset
+		opt     Options
+		cluster string
 	}
 
 	Options struct {
@@ -109,8 +118,9 @@ func NewBackend(ctx context.Context, m configmap.Mapper) (place.Backend, error)
 	}
 
 	return &Backend{
-		client: clientset,
-		opt:    *opt,
+		client:  clientset,
+		opt:     *opt,
+		cluster: kubeConfig.Contexts[activeContext].Cluster,
 	}, nil
 }
 
@@ -123,45 +133,265 @@ func (b *Backend) CacheKeyName(pattern string) string {
 }
 
 func (b *Backend) List(ctx context.Context, backendName string, pattern string) (place.Printable, error) {
+	return b.ListQuery(ctx, backendName, &query.Query{Pattern: pattern})
+}
+
+// ListQuery pushes the query terms down as pod field selectors
+func (b *Backend) ListQuery(ctx context.Context, backendName string, q *query.Query) (place.Printable, error) {
+	return place.Collect(func(out chan<- place.Printable) error {
+		return b.Stream(ctx, backendName, q, out)
+	})
+}
+
+// Stream sends the pods page by page, following the continue tokens
+func (b *Backend) Stream(ctx context.Context, backendName string, q *query.Query, out chan<- place.Printable) error {
+	ms, err := place.PatternMatchers(ctx, q)
+	if err != nil {
+		return err
+	}
+
+	return b.stream(ctx, backendName, ms, len(q.Patterns) > 0, fieldSelector(q.Terms), out)
+}
+
+// fieldSelector returns the field selector of the terms, field
+// selectors only support exact matches of a few pod fields
+func fieldSelector(terms query.Terms) string {
+	selectors := make([]fields.Selector, 0)
+	for _, t := range terms {
+		if t.Op != query.OpEqual && t.Op != query.OpNotEqual {
+			continue
+		}
+
+		var field, value string
+		switch {
+		case t.Field == query.FieldName:
+			// pod names are lowercase RFC 1123 subdomains
+			field, value = "metadata.name", strings.ToLower(t.Value)
+		case t.Field == query.FieldStatus:
+			// phases are capitalized, e.g. Running
+			value = strings.ToLower(t.Value)
+			field, value = "status.phase", strings.ToUpper(value[:1])+value[1:]
+		case t.Field == query.FieldPrivateIP && t.IsIP():
+			field, value = "status.podIP", t.Value
+		default:
+			continue
+		}
+
+		if t.Negative() {
+			selectors = append(selectors, fields.OneTermNotEqualSelector(field, value))
+		} else {
+			selectors = append(selectors, fields.OneTermEqualSelector(field, value))
+		}
+	}
+
+	return fields.AndSelectors(selectors...).String()
+}
+
+func (b *Backend) stream(ctx context.Context, backendName string, ms []*query.Matcher, tag bool, selector string, out chan<- place.Printable) error {
 	ns := ""
 	if b.opt.Namespace != "" {
 		ns = b.opt.Namespace
 	}
 
-	log.Debugf("using namespace: %s", ns)
+	log.Debugf("using namespace: %s, field selector: %s", ns, selector)
 
-	podFilter, err := regexp.Compile(fmt.Sprintf(".*%s.*", pattern))
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to compile regular expression from query")
+	var nodes map[string]map[string]string
+	opts := metav1.ListOptions{FieldSelector: selector, Limit: pageSize}
+	for {
+		var pods *corev1.PodList
+		if err := place.Call(ctx, apierrors.IsTooManyRequests, func() (err error) {
+			pods, err = b.client.
+				CoreV1().
+				Pods(ns).
+				List(ctx, opts)
+			return err
+		}); err != nil {
+			return err
+		}
+
+		instances := make(place.Printable, 0)
+		for _, pod := range pods.Items {
+			patterns := place.MatchedPatterns(ms, func(m *query.Matcher) bool {
+				return matchPattern(&pod, m)
+			})
+			if len(patterns) == 0 {
+				continue
+			}
+
+			if nodes == nil {
+				nodes = b.nodesLabels(ctx)
+			}
+
+			i := b.newInstance(backendName, pod, nodes[pod.Spec.NodeName])
+			if tag {
+				i.Patterns = patterns
+			}
+
+			instances = append(instances, i)
+		}
+
+		if err := place.SendPage(ctx, out, instances); err != nil {
+			return err
+		}
+
+		if pods.Continue == "" {
+			return nil
+		}
+
+		opts.Continue = pods.Continue
+	}
+}
+
+// Get returns the pod by `namespace/name`, by name in the configured
+// namespace or by UID
+func (b *Backend) Get(ctx context.Context, backendName string, id string) (*place.Instance, error) {
+	ns, name := b.opt.Namespace, id
+	if i := strings.Index(id, "/"); i >= 0 {
+		ns, name = id[:i], id[i+1:]
+	}
+
+	pod, err := b.getPod(ctx, ns, name)
+	if apierrors.IsNotFound(err) && !strings.Contains(id, "/") {
+		pod, err = b.findPodByUID(ctx, ns, id)
 	}
 
-	pods, err := b.client.
-		CoreV1().
-		Pods(ns).
-		List(ctx, metav1.ListOptions{})
 	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, place.ErrInstanceNotFound
+		}
+
 		return nil, err
 	}
 
-	instances := make([]*place.Instance, 0)
-	for _, pod := range pods.Items {
-		if !podFilter.MatchString(pod.Name) {
-			continue
+	return b.newInstance(backendName, *pod, b.nodeLabels(ctx, pod.Spec.NodeName)), nil
+}
+
+func (b *Backend) getPod(ctx context.Context, ns string, name string) (pod *corev1.Pod, err error) {
+	// a pod name needs a namespace
+	if ns == "" {
+		return nil, apierrors.NewNotFound(corev1.Resource("pods"), name)
+	}
+
+	err = place.Call(ctx, apierrors.IsTooManyRequests, func() (err error) {
+		pod, err = b.client.CoreV1().Pods(ns).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+
+	return pod, err
+}
+
+// findPodByUID lists the pods of the namespace, all of them if empty,
+// there is no field selector for the UID
+func (b *Backend) findPodByUID(ctx context.Context, ns string, uid string) (*corev1.Pod, error) {
+	opts := metav1.ListOptions{Limit: pageSize}
+	for {
+		var pods *corev1.PodList
+		if err := place.Call(ctx, apierrors.IsTooManyRequests, func() (err error) {
+			pods, err = b.client.CoreV1().Pods(ns).List(ctx, opts)
+			return err
+		}); err != nil {
+			return nil, err
 		}
 
-		instances = append(instances, &place.Instance{
-			Model: place.Model{
-				BackendName: backendName,
-				ID:          string(pod.UID),
-				Name:        pod.Name,
-				Type:        "pod",
-				Status:      string(pod.Status.Phase),
-				PrivateIP:   pod.Status.PodIP,
-				PublicIP:    pod.Status.HostIP,
-			},
-			Raw: pod,
-		})
+		for i := range pods.Items {
+			if string(pods.Items[i].UID) == uid {
+				return &pods.Items[i], nil
+			}
+		}
+
+		if pods.Continue == "" {
+			return nil, apierrors.NewNotFound(corev1.Resource("pods"), uid)
+		}
+
+		opts.Continue = pods.Continue
+	}
+}
+
+func (b *Backend) newInstance(backendName string, pod corev1.Pod, nodeLabels map[string]string) *place.Instance {
+	createdAt := pod.CreationTimestamp.Time
+
+	return &place.Instance{
+		Model: place.Model{
+			BackendName: backendName,
+			ID:          string(pod.UID),
+			Name:        pod.Name,
+			Type:        "pod",
+			Status:      string(pod.Status.Phase),
+			PrivateIP:   pod.Status.PodIP,
+			PublicIP:    pod.Status.HostIP,
+			Region:      firstLabel(nodeLabels, corev1.LabelTopologyRegion, corev1.LabelFailureDomainBetaRegion),
+			Zone:        firstLabel(nodeLabels, corev1.LabelTopologyZone, corev1.LabelFailureDomainBetaZone),
+			Account:     b.cluster,
+			CreatedAt:   &createdAt,
+			Labels:      pod.Labels,
+		},
+		Raw: pod,
+	}
+}
+
+// matchPattern returns true if the pod ip or host ip is in the network
+// of an ip pattern, or if the pod name matches the pattern otherwise
+func matchPattern(pod *corev1.Pod, m *query.Matcher) bool {
+	if network := query.ParseNetwork(m.Pattern); network != nil {
+		ips := []string{pod.Status.PodIP, pod.Status.HostIP}
+		for _, ip := range pod.Status.PodIPs {
+			ips = append(ips, ip.IP)
+		}
+
+		return query.NetworkContains(network, ips...)
+	}
+
+	return m.Match(pod.Name)
+}
+
+// nodesLabels returns the labels of the cluster nodes by node name,
+// the region and zone of a pod are the ones of its node. Listing the
+// nodes may be forbidden, the pods are returned without them then.
+func (b *Backend) nodesLabels(ctx context.Context) map[string]map[string]string {
+	labels := make(map[string]map[string]string)
+
+	var nodes *corev1.NodeList
+	if err := place.Call(ctx, apierrors.IsTooManyRequests, func() (err error) {
+		nodes, err = b.client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+		return err
+	}); err != nil {
+		log.Debugf("can't list nodes: %v", err)
+
+		return labels
+	}
+
+	for _, node := range nodes.Items {
+		labels[node.Name] = node.Labels
+	}
+
+	return labels
+}
+
+// nodeLabels returns the labels of a single node, nil if it can't be read
+func (b *Backend) nodeLabels(ctx context.Context, name string) map[string]string {
+	if name == "" {
+		return nil
+	}
+
+	var node *corev1.Node
+	if err := place.Call(ctx, apierrors.IsTooManyRequests, func() (err error) {
+		node, err = b.client.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+		return err
+	}); err != nil {
+		log.Debugf("can't get node %s: %v", name, err)
+
+		return nil
+	}
+
+	return node.Labels
+}
+
+func firstLabel(labels map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if v, ok := labels[key]; ok {
+			return v
+		}
 	}
 
-	return instances, nil
+	return ""
 }
@@ -2,9 +2,7 @@ package macstadium
 
 import (
 	"context"
-	"fmt"
 	"net/http"
-	"regexp"
 	"strconv"
 	"time"
 
@@ -20,6 +18,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/bringg/honey/pkg/place"
+	"github.com/bringg/honey/pkg/place/query"
 )
 
 const (
@@ -48,7 +47,7 @@ type (
 	Backend struct {
 		opt    Options
 		client *rest.Client
-		pacer  *fs.Pacer // To pace and retry the API calls
+		pacer  *fs.Pacer // To retry the API calls, place.Call paces them
 	}
 
 	// Options defines the configuration for this backend
@@ -146,13 +145,18 @@ func (b *Backend) List(ctx context.Context, backendName string, pattern string)
 		return nil, err
 	}
 
-	filter, err := regexp.Compile(fmt.Sprintf("(?i).*%s.*", pattern))
+	match, err := serverMatcher(ctx, pattern)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to compile regular expression from query")
+		return nil, err
 	}
 
 	instances := make([]*place.Instance, 0)
 	for _, server := range servers {
+		// match before the status, it costs a request per server
+		if !match(server) {
+			continue
+		}
+
 		status, err := b.serverStatus(ctx, server.ID)
 		if err != nil {
 			return nil, err
@@ -160,25 +164,72 @@ func (b *Backend) List(ctx context.Context, backendName string, pattern string)
 
 		server.Status = status
 
-		if !filter.MatchString(server.Name) {
+		instances = append(instances, b.newInstance(backendName, server))
+	}
+
+	return instances, nil
+}
+
+// Get returns the server of the id, the API has no single server
+// endpoint so the servers are listed
+func (b *Backend) Get(ctx context.Context, backendName string, id string) (*place.Instance, error) {
+	servers, err := b.listAllServers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, server := range servers {
+		if server.ID != id {
 			continue
 		}
 
-		instances = append(instances, &place.Instance{
-			Model: place.Model{
-				BackendName: backendName,
-				ID:          server.ID,
-				Name:        server.Name,
-				Type:        "macOs",
-				Status:      status.Power,
-				PrivateIP:   "",
-				PublicIP:    server.IP,
-			},
-			Raw: server,
-		})
+		status, err := b.serverStatus(ctx, server.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		server.Status = status
+
+		return b.newInstance(backendName, server), nil
 	}
 
-	return instances, nil
+	return nil, place.ErrInstanceNotFound
+}
+
+func (b *Backend) newInstance(backendName string, server *Server) *place.Instance {
+	return &place.Instance{
+		Model: place.Model{
+			BackendName: backendName,
+			ID:          server.ID,
+			Name:        server.Name,
+			Type:        "macOs",
+			Status:      server.Status.Power,
+			PrivateIP:   "",
+			PublicIP:    server.IP,
+			Account:     b.opt.UserName,
+			Labels:      map[string]string{},
+		},
+		Raw: server,
+	}
+}
+
+// serverMatcher returns the matcher of the pattern, the server ip if
+// the pattern is an ip address or a network, the server name otherwise
+func serverMatcher(ctx context.Context, pattern string) (func(server *Server) bool, error) {
+	if network := query.ParseNetwork(pattern); network != nil {
+		return func(server *Server) bool {
+			return query.NetworkContains(network, server.IP)
+		}, nil
+	}
+
+	m, err := place.PatternMatcher(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(server *Server) bool {
+		return m.Match(server.Name)
+	}, nil
 }
 
 func (b *Backend) listAllServers(ctx context.Context) ([]*Server, error) {
@@ -192,7 +243,11 @@ func (b *Backend) listAllServers(ctx context.Context) ([]*Server, error) {
 
 	servers := make([]*Server, 0)
 	if err := b.pacer.Call(func() (bool, error) {
-		resp, err := b.client.CallJSON(ctx, &opts, nil, &servers)
+		var resp *http.Response
+		err := place.Call(ctx, nil, func() (err error) {
+			resp, err = b.client.CallJSON(ctx, &opts, nil, &servers)
+			return err
+		})
 		return b.shouldRetry(resp, err)
 	}); err != nil {
 		return nil, errors.Wrap(err, "failed to get server list")
@@ -212,7 +267,11 @@ func (b *Backend) serverStatus(ctx context.Context, id string) (*ServerStatus, e
 
 	status := &ServerStatus{}
 	if err := b.pacer.Call(func() (bool, error) {
-		resp, err := b.client.CallJSON(ctx, &opts, nil, status)
+		var resp *http.Response
+		err := place.Call(ctx, nil, func() (err error) {
+			resp, err = b.client.CallJSON(ctx, &opts, nil, status)
+			return err
+		})
 		return b.shouldRetry(resp, err)
 	}); err != nil {
 		return nil, errors.Wrap(err, "failed to get server status")
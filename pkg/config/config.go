@@ -685,6 +685,14 @@ func FileSet(section, key, value string) {
 	}
 }
 
+// FileSections returns the sections of the config file, sorted
+func FileSections() []string {
+	sections := getSectionList()
+	sort.Strings(sections)
+
+	return sections
+}
+
 func getSectionList() (backends []string) {
 	keys := new(map[string]interface{})
 	if err := getConfigData().Unmarshal(keys); err != nil {
@@ -1,6 +1,8 @@
 package configflags
 
 import (
+	"strings"
+
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 
@@ -20,9 +22,30 @@ var (
 func AddFlags(ci *place.ConfigInfo, flagSet *pflag.FlagSet) {
 	flags.CountVarP(flagSet, &verbose, "verbose", "v", "Print lots more stuff (repeat for more)")
 	flags.BoolVarP(flagSet, &ci.NoColor, "no-color", "", ci.NoColor, "disable colorize the json for outputing to the screen")
+	flags.BoolVarP(flagSet, &ci.NoHeaders, "no-headers", "", ci.NoHeaders, "don't print the header line of the csv and tsv outputs")
 	flags.BoolVarP(flagSet, &quiet, "quiet", "q", quiet, "Print as little stuff as possible")
 	flags.BoolVarP(flagSet, &ci.NoCache, "no-cache", "", ci.NoCache, "no-cache will skip lookup in cache")
 	flags.DurationVarP(flagSet, &ci.CacheTTL, "cache-ttl", "", ci.CacheTTL, "cache-ttl cache duration in seconds")
+	flags.DurationVarP(flagSet, &ci.StaleTTL, "stale-ttl", "", ci.StaleTTL, "serve the cache up to stale-ttl after it expired while it is refreshed in the background, 0 to disable")
+	flags.DurationVarP(flagSet, &ci.NegativeCacheTTL, "negative-cache-ttl", "", ci.NegativeCacheTTL, "cache the searches which found nothing for negative-cache-ttl, 0 not to cache them")
+	flags.StringVarP(flagSet, &ci.CacheBackend, "cache-backend", "", ci.CacheBackend, "where the cache is kept: badger|memory|file|redis")
+	flags.StringVarP(flagSet, &ci.CacheDir, "cache-dir", "", ci.CacheDir, "directory of the badger and file caches, default ~/.cache/honey-cachedb or ~/.cache/honey-cache")
+	flags.StringVarP(flagSet, &ci.CacheRedisURL, "cache-redis-url", "", ci.CacheRedisURL, "redis://[:password@]host[:port][/db] of the redis cache, default redis://localhost:6379/0")
+	flags.BoolVarP(flagSet, &ci.CacheEncrypt, "cache-encrypt", "", ci.CacheEncrypt, "ask for the password the cache and the index are encrypted with, unless $HONEY_CACHE_PASSWORD is set")
+	flags.BoolVarP(flagSet, &ci.Offline, "offline", "", ci.Offline, "search the local index of honey sync only, without calling the backends")
+	flags.DurationVarP(flagSet, &ci.SyncInterval, "sync-interval", "", ci.SyncInterval, "honey sync skips the backends synced since, unless --force")
+	flags.StringVarP(flagSet, &ci.IndexDir, "index-dir", "", ci.IndexDir, "directory of the index of honey sync, default ~/.cache/honey-index")
+	flags.StringVarP(flagSet, &ci.FromSnapshot, "from-snapshot", "", ci.FromSnapshot, "search the file of honey snapshot save, without calling the backends")
+	flags.DurationVarP(flagSet, &ci.Timeout, "timeout", "", ci.Timeout, "maximum time to wait for each backend, 0 to wait forever")
+	flags.IntVarP(flagSet, &ci.MaxConcurrency, "max-concurrency", "", ci.MaxConcurrency, "maximum backend API calls running at once, 0 for no limit")
+	flags.StringVarP(flagSet, &ci.MatchMode, "match", "", ci.MatchMode, "how the filter pattern is matched: substring|prefix|exact|glob|regex|fuzzy")
+	flags.BoolVarP(flagSet, &ci.IgnoreCase, "ignore-case", "i", ci.IgnoreCase, "match the filter pattern case insensitive")
+	flags.StringVarP(flagSet, &ci.Merge, "merge", "", ci.Merge, "merge the instances of the same host found by several backends, on any of id,ip,name")
+	flagSet.Lookup("merge").NoOptDefVal = strings.Join(place.MergeRules, ",")
+	flags.StringVarP(flagSet, &ci.SortBy, "sort-by", "", ci.SortBy, "sort the instances by a gjson path, e.g. created_at or raw.launch_time")
+	flags.BoolVarP(flagSet, &ci.Reverse, "reverse", "", ci.Reverse, "reverse the order of --sort-by")
+	flags.StringVarP(flagSet, &ci.GroupBy, "group-by", "", ci.GroupBy, "group the instances by a gjson path, e.g. region or labels.env")
+	flags.IntVarP(flagSet, &ci.Limit, "limit", "", ci.Limit, "show only the first N instances, the best matches with --match fuzzy, 0 for all")
 	flags.StringVarP(flagSet, &configPath, "config", "c", config.GetConfigPath(), "config file")
 	flags.StringVarP(flagSet, &ci.OutFormat, "output", "o", ci.OutFormat, "")
 	flags.StringVarP(flagSet, &ci.BackendsString, "backends", "b", ci.BackendsString, "")
@@ -0,0 +1,306 @@
+package cache
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/vmihailenco/msgpack/v5"
+	"golang.org/x/sync/errgroup"
+)
+
+// badgerStore keeps the entries in a badger database, it is locked by
+// the process which opened it
+type badgerStore struct {
+	db  *badger.DB
+	dir string
+}
+
+// NewBadgerStore returns the store of the badger database in dir,
+// encrypted with key if it isn't empty. The database is opened on first
+// use, if it can't be, e.g. it is locked by another honey process, the
+// entries are kept in a file store next to it instead, or in memory if
+// the key is wrong. A warning is logged and Info tells why.
+func NewBadgerStore(dir string, key []byte) (Store, error) {
+	// the fallback is checked first, it can't fail once the database is
+	// opened
+	fallbackDir := dir + "-files"
+	fallback, err := NewFileStore(fallbackDir, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &lazyStore{
+		open: func() (Store, error) {
+			db, err := badger.Open(badgerOptions(dir, key))
+			if err != nil {
+				return nil, err
+			}
+
+			return &badgerStore{db: db, dir: dir}, nil
+		},
+		fallback: func(err error) Store {
+			log := logrus.WithField("where", "store")
+			if errors.Is(err, badger.ErrEncryptionKeyMismatch) {
+				log.Warnf("can't open the cache %s, it is encrypted with another password, caching in memory", dir)
+
+				return NewMemoryStore()
+			}
+
+			log.Warnf("can't open the cache %s, e.g. honey serve uses it, using %s: %v", dir, fallbackDir, err)
+
+			return fallback
+		},
+	}, nil
+}
+
+// badgerOptions returns the options of the database in dir
+func badgerOptions(dir string, key []byte) badger.Options {
+	opt := badger.DefaultOptions(dir)
+	opt.Logger = &logger{logrus.WithField("where", "store")}
+
+	if len(key) > 0 {
+		opt.EncryptionKey = key
+		// the encrypted tables indexes are cached decrypted
+		opt.IndexCacheSize = 64 << 20
+	}
+
+	return opt
+}
+
+// rotateBadgerKey encrypts the database in dir with newKey instead of
+// oldKey. The data keys of an encrypted database are encrypted again,
+// an unencrypted database is copied to a new encrypted one, so none of
+// its entries are left unencrypted on disk.
+func rotateBadgerKey(dir string, oldKey, newKey []byte) error {
+	// the copy of an interrupted encryption is complete once the
+	// database is removed
+	tmp := filepath.Clean(dir) + ".rotate"
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if _, err := os.Stat(tmp); err == nil {
+			return os.Rename(tmp, dir)
+		}
+	}
+
+	// opening the database checks the key and that no other process
+	// uses it
+	db, err := badger.Open(badgerOptions(dir, oldKey))
+	if errors.Is(err, badger.ErrEncryptionKeyMismatch) {
+		// the database of an interrupted rotation
+		if db, err := badger.Open(badgerOptions(dir, newKey)); err == nil {
+			return db.Close()
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if len(oldKey) == 0 {
+		return encryptBadger(db, dir, newKey)
+	}
+
+	if err := db.Close(); err != nil {
+		return err
+	}
+
+	opt := badger.KeyRegistryOptions{
+		Dir:           dir,
+		ReadOnly:      true,
+		EncryptionKey: oldKey,
+	}
+
+	kr, err := badger.OpenKeyRegistry(opt)
+	if err != nil {
+		return err
+	}
+
+	opt.EncryptionKey = newKey
+
+	return badger.WriteKeyRegistry(kr, opt)
+}
+
+// encryptBadger copies the entries of the unencrypted database db, in
+// dir, to a new database encrypted with key, which replaces it
+func encryptBadger(db *badger.DB, dir string, key []byte) error {
+	tmp := filepath.Clean(dir) + ".rotate"
+	if err := os.RemoveAll(tmp); err != nil {
+		db.Close()
+
+		return err
+	}
+
+	to, err := badger.Open(badgerOptions(tmp, key))
+	if err != nil {
+		db.Close()
+
+		return err
+	}
+
+	r, w := io.Pipe()
+
+	var g errgroup.Group
+	g.Go(func() error {
+		// the expired entries are skipped, the others keep their ttl
+		_, err := db.Backup(w, 0)
+		w.CloseWithError(err)
+
+		return err
+	})
+	g.Go(func() error {
+		err := to.Load(r, 256)
+		r.CloseWithError(err)
+
+		return err
+	})
+
+	err = g.Wait()
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+
+	if closeErr := to.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.RemoveAll(tmp)
+
+		return err
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, dir)
+}
+
+// Info _
+func (s *badgerStore) Info() *Info {
+	return &Info{
+		Backend:   BackendBadger,
+		Location:  s.dir,
+		Encrypted: len(s.db.Opts().EncryptionKey) > 0,
+	}
+}
+
+// Close _
+func (s *badgerStore) Close() error {
+	return s.db.Close()
+}
+
+// Put _
+func (s *badgerStore) Put(bucket string, key []byte, value interface{}, ttl time.Duration) error {
+	if err := s.db.Update(func(txn *badger.Txn) error {
+		data, err := msgpack.Marshal(value)
+		if err != nil {
+			return err
+		}
+
+		// badger expires the entries to the second, the expiry is rounded
+		// up so they are kept for the ttl at least
+		e := badger.NewEntry(entryKey(bucket, key), data)
+		if ttl > 0 {
+			e.ExpiresAt = uint64(time.Now().Add(ttl + time.Second - 1).Unix())
+		}
+
+		return txn.SetEntry(e)
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Get _
+func (s *badgerStore) Get(bucket string, key []byte, v interface{}) error {
+	var value []byte
+	if err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(entryKey(bucket, key))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return ErrNotFound
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			value = append([]byte{}, val...)
+
+			return nil
+		})
+	}); err != nil {
+		return err
+	}
+
+	return msgpack.Unmarshal(value, v)
+}
+
+// Delete deletes the entry of the key
+func (s *badgerStore) Delete(bucket string, key []byte) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(entryKey(bucket, key))
+	})
+}
+
+// DropPrefix deletes the entries of the bucket whose key starts with
+// prefix, all the entries of the store if bucket is empty
+func (s *badgerStore) DropPrefix(bucket string, prefix []byte) error {
+	if bucket == "" {
+		return s.db.DropAll()
+	}
+
+	return s.db.DropPrefix(append(bucketPrefix(bucket), prefix...))
+}
+
+// Iterate calls fn with the entries of the bucket, of all the buckets
+// if bucket is empty, in key order. Expired entries are skipped.
+func (s *badgerStore) Iterate(bucket string, fn func(e *Entry) error) error {
+	return s.db.View(func(txn *badger.Txn) error {
+		opt := badger.DefaultIteratorOptions
+		opt.PrefetchValues = false
+		if bucket != "" {
+			opt.Prefix = bucketPrefix(bucket)
+		}
+
+		it := txn.NewIterator(opt)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+
+			b, key, ok := splitEntryKey(item.KeyCopy(nil))
+			if !ok {
+				// left by an older version of the store
+				continue
+			}
+
+			e := &Entry{
+				Bucket: b,
+				Key:    key,
+				Size:   item.EstimatedSize(),
+			}
+
+			if item.ExpiresAt() > 0 {
+				e.ExpiresAt = time.Unix(int64(item.ExpiresAt()), 0)
+			}
+
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Stats _
+func (s *badgerStore) Stats() ([]*Stats, error) {
+	return collectStats(s)
+}
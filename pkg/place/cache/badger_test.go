@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestBadgerStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+
+	s, err := NewBadgerStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// badger expires the entries to the second
+	testStore(t, s, func() {
+		time.Sleep(time.Second + 2*testTTL)
+	})
+
+	if err := s.Put("aws", []byte("api"), &testValue{Name: "api"}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the entries without a ttl are kept
+	if s, err = NewBadgerStore(dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	v := new(testValue)
+	if err := s.Get("aws", []byte("api"), v); err != nil || v.Name != "api" {
+		t.Errorf("got %q, %v once reopened, want the entry", v.Name, err)
+	}
+}
+
+func TestBadgerStoreFallback(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	dir := filepath.Join(t.TempDir(), "cache")
+
+	// the first store holds the lock of the database
+	holder, err := NewBadgerStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Close()
+
+	if err := holder.Put("aws", []byte("api"), &testValue{Name: "api"}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewBadgerStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.Put("aws", []byte("db"), &testValue{Name: "db"}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if info := s.Info(); info.Backend != BackendFile || info.Location != dir+"-files" || info.Fallback == "" {
+		t.Errorf("got info %+v, want the file store next to the database and why", info)
+	}
+
+	if info := holder.Info(); info.Backend != BackendBadger || info.Fallback != "" {
+		t.Errorf("got info %+v of the store holding the lock", info)
+	}
+
+	if e := hook.LastEntry(); e == nil || e.Level != logrus.WarnLevel {
+		t.Errorf("got log %v, want a warning", e)
+	}
+
+	// the file store is shared by the processes which can't open the
+	// database
+	files, err := NewFileStore(dir+"-files", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := files.Get("aws", []byte("db"), new(testValue)); err != nil {
+		t.Errorf("got %v for the entry of the fallback", err)
+	}
+}
+
+func TestBadgerStoreWrongKey(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+
+	s, err := NewBadgerStore(dir, bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Put("aws", []byte("api"), &testValue{Name: "api"}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err = NewBadgerStore(dir, bytes.Repeat([]byte{2}, 32)); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.Get("aws", []byte("api"), new(testValue)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v with another key, want ErrNotFound", err)
+	}
+
+	if info := s.Info(); info.Backend != BackendMemory || info.Fallback == "" {
+		t.Errorf("got info %+v, want the memory store and why", info)
+	}
+}
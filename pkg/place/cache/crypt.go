@@ -0,0 +1,208 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// saltSize is the size of the random salt of a store
+	saltSize = 16
+	// the scrypt cost parameters, ~100ms to derive a key
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// sealedMagic starts the values sealed by a sealer
+var sealedMagic = []byte("HNYENC1")
+
+// ErrEncrypted is returned reading an encrypted entry without the key
+var ErrEncrypted = errors.New("cache entry is encrypted, the cache password is needed")
+
+// sealer encrypts the values of the stores which have no encryption of
+// their own with AES-GCM. A nil sealer leaves them as is.
+type sealer struct {
+	aead cipher.AEAD
+	// rotated opens the values sealed with the new key of an interrupted
+	// rotate-key, and unsealed accepts the values which aren't sealed,
+	// only rotate-key reads them to encrypt all the entries with its key
+	rotated  cipher.AEAD
+	unsealed bool
+}
+
+// KeyFromPassword returns the AES-256 encryption key of the password
+// and the salt of a store, derived with scrypt
+func KeyFromPassword(password string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(password), salt, scryptN, scryptR, scryptP, 32)
+}
+
+// newSalt returns a random salt
+func newSalt() ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	return salt, nil
+}
+
+// readSaltFile returns the salt saved in path, a new one is saved if
+// there is none. The salt isn't secret, it makes the keys of the same
+// password different for every store.
+func readSaltFile(path string) ([]byte, error) {
+	salt, err := os.ReadFile(path)
+	if err == nil {
+		return salt, nil
+	}
+
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if salt, err = newSalt(); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), tempPrefix)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(salt); err != nil {
+		f.Close()
+
+		return nil, err
+	}
+
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	// the salt is linked once complete, if another process saved one
+	// meanwhile its salt is used
+	if err := os.Link(f.Name(), path); os.IsExist(err) {
+		return os.ReadFile(path)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return salt, nil
+}
+
+// savedSalt returns true if a salt is saved in path
+func savedSalt(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// newSealer returns the sealer of the key, nil if the key is empty
+func newSealer(key []byte) (*sealer, error) {
+	if len(key) == 0 {
+		return nil, nil
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid cache encryption key")
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sealer{aead: aead}, nil
+}
+
+// migrating returns the sealer of rotate-key to newKey, it also opens
+// the values which aren't sealed and the ones already sealed with newKey
+func (s *sealer) migrating(newKey []byte) (*sealer, error) {
+	to, err := newSealer(newKey)
+	if err != nil || to == nil {
+		return s, err
+	}
+
+	m := &sealer{rotated: to.aead, unsealed: true}
+	if s != nil {
+		m.aead = s.aead
+	}
+
+	return m, nil
+}
+
+// seal returns the encrypted data
+func (s *sealer) seal(data []byte) ([]byte, error) {
+	if s == nil {
+		return data, nil
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	out := append(append([]byte{}, sealedMagic...), nonce...)
+
+	return s.aead.Seal(out, nonce, data, sealedMagic), nil
+}
+
+// open returns the decrypted data. The values which aren't sealed are
+// a miss, anyone who can write to the store could plant them otherwise.
+func (s *sealer) open(data []byte) ([]byte, error) {
+	sealed := bytes.HasPrefix(data, sealedMagic)
+
+	switch {
+	case s == nil && sealed:
+		return nil, ErrEncrypted
+	case s == nil || (!sealed && s.unsealed):
+		return data, nil
+	case !sealed:
+		return nil, ErrNotFound
+	}
+
+	data = data[len(sealedMagic):]
+
+	plain, err := openSealed(s.aead, data)
+	if err != nil && s.rotated != nil {
+		plain, err = openSealed(s.rotated, data)
+	}
+
+	return plain, err
+}
+
+// openSealed returns the data sealed with aead, without the magic
+func openSealed(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if aead == nil {
+		return nil, ErrEncrypted
+	}
+
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("cache entry is truncated")
+	}
+
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, sealedMagic)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't decrypt the cache entry, wrong cache password")
+	}
+
+	return plain, nil
+}
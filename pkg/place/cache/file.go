@@ -0,0 +1,346 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// tempPrefix prefixes the files being written, they are renamed once
+// complete so the readers never see a partial entry
+const tempPrefix = ".tmp-"
+
+type (
+	// fileStore keeps every entry in a file of the directory of its
+	// bucket. The files are replaced atomically, so several processes
+	// can share the directory.
+	fileStore struct {
+		dir    string
+		sealer *sealer
+	}
+
+	// fileEntry is the content of an entry file
+	fileEntry struct {
+		Key       []byte             `msgpack:"key"`
+		ExpiresAt time.Time          `msgpack:"expires_at"`
+		Value     msgpack.RawMessage `msgpack:"value"`
+	}
+)
+
+// NewFileStore returns a store which keeps the entries in files under
+// dir, encrypted with key if it isn't empty
+func NewFileStore(dir string, key []byte) (Store, error) {
+	return newFileStore(dir, key)
+}
+
+func newFileStore(dir string, key []byte) (*fileStore, error) {
+	sealer, err := newSealer(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileStore{dir: dir, sealer: sealer}, nil
+}
+
+// rotateFileKey encrypts the entries of the file store in dir with
+// newKey instead of oldKey, the unencrypted ones too
+func rotateFileKey(dir string, oldKey, newKey []byte) error {
+	from, err := newFileStore(dir, oldKey)
+	if err != nil {
+		return err
+	}
+
+	if from.sealer, err = from.sealer.migrating(newKey); err != nil {
+		return err
+	}
+
+	to, err := newFileStore(dir, newKey)
+	if err != nil {
+		return err
+	}
+
+	return from.Iterate("", func(e *Entry) error {
+		fe, _, err := from.readEntry(from.entryPath(e.Bucket, e.Key))
+		if err == ErrNotFound {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return to.write(e.Bucket, fe)
+	})
+}
+
+func (e *fileEntry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+func (s *fileStore) bucketDir(bucket string) string {
+	return filepath.Join(s.dir, url.PathEscape(bucket))
+}
+
+// entryPath returns the path of the entry file, the key is hashed as it
+// can be longer than a file name
+func (s *fileStore) entryPath(bucket string, key []byte) string {
+	sum := sha256.Sum256(cacheKeyName(key))
+
+	return filepath.Join(s.bucketDir(bucket), hex.EncodeToString(sum[:]))
+}
+
+// Put _
+func (s *fileStore) Put(bucket string, key []byte, value interface{}, ttl time.Duration) error {
+	data, err := msgpack.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	e := &fileEntry{
+		Key:   cacheKeyName(key),
+		Value: data,
+	}
+
+	if ttl > 0 {
+		e.ExpiresAt = time.Now().Add(ttl)
+	}
+
+	return s.write(bucket, e)
+}
+
+// write replaces the file of the entry
+func (s *fileStore) write(bucket string, e *fileEntry) error {
+	b, err := msgpack.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if b, err = s.sealer.seal(b); err != nil {
+		return err
+	}
+
+	dir := s.bucketDir(bucket)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dir, tempPrefix)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+
+		return err
+	}
+
+	if err := os.Rename(f.Name(), s.entryPath(bucket, e.Key)); err != nil {
+		os.Remove(f.Name())
+
+		return err
+	}
+
+	return nil
+}
+
+// Get _
+func (s *fileStore) Get(bucket string, key []byte, v interface{}) error {
+	e, _, err := s.readEntry(s.entryPath(bucket, key))
+	if err != nil {
+		return err
+	}
+
+	if e.expired(time.Now()) {
+		return ErrNotFound
+	}
+
+	return msgpack.Unmarshal(e.Value, v)
+}
+
+// Delete _
+func (s *fileStore) Delete(bucket string, key []byte) error {
+	if err := os.Remove(s.entryPath(bucket, key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// DropPrefix _
+func (s *fileStore) DropPrefix(bucket string, prefix []byte) error {
+	if bucket == "" {
+		buckets, err := s.buckets()
+		if err != nil {
+			return err
+		}
+
+		for _, b := range buckets {
+			if err := os.RemoveAll(s.bucketDir(b)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if len(prefix) == 0 {
+		return os.RemoveAll(s.bucketDir(bucket))
+	}
+
+	return s.Iterate(bucket, func(e *Entry) error {
+		if !bytes.HasPrefix(e.Key, prefix) {
+			return nil
+		}
+
+		return s.Delete(bucket, e.Key)
+	})
+}
+
+// Iterate _
+func (s *fileStore) Iterate(bucket string, fn func(e *Entry) error) error {
+	buckets := []string{bucket}
+	if bucket == "" {
+		var err error
+		if buckets, err = s.buckets(); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	entries := make([]*Entry, 0)
+	for _, b := range buckets {
+		dir := s.bucketDir(b)
+		files, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		for _, f := range files {
+			if f.IsDir() || strings.HasPrefix(f.Name(), tempPrefix) {
+				continue
+			}
+
+			fe, size, err := s.readEntry(filepath.Join(dir, f.Name()))
+			if err == ErrNotFound {
+				// deleted by another process
+				continue
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if fe.expired(now) {
+				continue
+			}
+
+			entries = append(entries, &Entry{
+				Bucket:    b,
+				Key:       fe.Key,
+				Size:      size,
+				ExpiresAt: fe.ExpiresAt,
+			})
+		}
+	}
+
+	sortEntries(entries)
+
+	for _, e := range entries {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Stats _
+func (s *fileStore) Stats() ([]*Stats, error) {
+	return collectStats(s)
+}
+
+// Info _
+func (s *fileStore) Info() *Info {
+	return &Info{
+		Backend:   BackendFile,
+		Location:  s.dir,
+		Encrypted: s.sealer != nil,
+	}
+}
+
+// Close _
+func (s *fileStore) Close() error {
+	return nil
+}
+
+// buckets returns the buckets which have a directory
+func (s *fileStore) buckets() ([]string, error) {
+	dirs, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make([]string, 0, len(dirs))
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+
+		b, err := url.PathUnescape(d.Name())
+		if err != nil {
+			continue
+		}
+
+		buckets = append(buckets, b)
+	}
+
+	return buckets, nil
+}
+
+// readEntry reads the entry file of path and returns its size,
+// ErrNotFound if it doesn't exist
+func (s *fileStore) readEntry(path string) (*fileEntry, int64, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, 0, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	plain, err := s.sealer.open(b)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	e := new(fileEntry)
+	if err := msgpack.Unmarshal(plain, e); err != nil {
+		return nil, 0, err
+	}
+
+	return e, int64(len(b)), nil
+}
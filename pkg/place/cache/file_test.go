@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+	s, err := NewFileStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testStore(t, s, func() {
+		time.Sleep(2 * testTTL)
+	})
+}
+
+func TestFileStoreEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	key := bytes.Repeat([]byte{1}, 32)
+
+	s, err := NewFileStore(dir, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testStore(t, s, func() {
+		time.Sleep(2 * testTTL)
+	})
+
+	if err := s.Put("aws", []byte("api"), &testValue{Name: "plaintext"}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "aws", "*"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("got entry files %v: %v", files, err)
+	}
+
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(data, sealedMagic) || bytes.Contains(data, []byte("plaintext")) {
+		t.Error("the entry isn't encrypted")
+	}
+
+	unencrypted, err := NewFileStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := unencrypted.Get("aws", []byte("api"), new(testValue)); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("got %v without the key, want ErrEncrypted", err)
+	}
+
+	// unencrypted entries are a miss, they are encrypted by rotate-key
+	if err := unencrypted.Put("aws", []byte("planted"), &testValue{Name: "planted"}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Get("aws", []byte("planted"), new(testValue)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v for an unencrypted entry, want ErrNotFound", err)
+	}
+
+	newKey := bytes.Repeat([]byte{2}, 32)
+	if err := rotateFileKey(dir, key, newKey); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := NewFileStore(dir, newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := new(testValue)
+	if err := rotated.Get("aws", []byte("api"), v); err != nil || v.Name != "plaintext" {
+		t.Errorf("got %q, %v with the new key", v.Name, err)
+	}
+
+	if err := rotated.Get("aws", []byte("planted"), v); err != nil || v.Name != "planted" {
+		t.Errorf("got %q, %v for the unencrypted entry with the new key", v.Name, err)
+	}
+
+	if err := s.Get("aws", []byte("api"), new(testValue)); err == nil {
+		t.Error("the old key still decrypts the entry")
+	}
+}
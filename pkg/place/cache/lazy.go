@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// lazyStore opens its store on first use, so the commands which don't
+// use the cache don't open it, and falls back to another store if it
+// can't be opened
+type lazyStore struct {
+	open func() (Store, error)
+	// fallback returns the store to use if open failed, nil to fail
+	fallback func(err error) Store
+
+	once  sync.Once
+	store Store
+	err   error
+	// openErr is the error of open if the fallback is used
+	openErr error
+}
+
+// get opens the store once
+func (s *lazyStore) get() (Store, error) {
+	s.once.Do(func() {
+		s.store, s.err = s.open()
+		if s.err == nil || s.fallback == nil {
+			return
+		}
+
+		if store := s.fallback(s.err); store != nil {
+			s.store, s.err, s.openErr = store, nil, s.err
+		}
+	})
+
+	return s.store, s.err
+}
+
+// Put _
+func (s *lazyStore) Put(bucket string, key []byte, value interface{}, ttl time.Duration) error {
+	store, err := s.get()
+	if err != nil {
+		return err
+	}
+
+	return store.Put(bucket, key, value, ttl)
+}
+
+// Get _
+func (s *lazyStore) Get(bucket string, key []byte, v interface{}) error {
+	store, err := s.get()
+	if err != nil {
+		return err
+	}
+
+	return store.Get(bucket, key, v)
+}
+
+// Delete _
+func (s *lazyStore) Delete(bucket string, key []byte) error {
+	store, err := s.get()
+	if err != nil {
+		return err
+	}
+
+	return store.Delete(bucket, key)
+}
+
+// DropPrefix _
+func (s *lazyStore) DropPrefix(bucket string, prefix []byte) error {
+	store, err := s.get()
+	if err != nil {
+		return err
+	}
+
+	return store.DropPrefix(bucket, prefix)
+}
+
+// Iterate _
+func (s *lazyStore) Iterate(bucket string, fn func(e *Entry) error) error {
+	store, err := s.get()
+	if err != nil {
+		return err
+	}
+
+	return store.Iterate(bucket, fn)
+}
+
+// Stats _
+func (s *lazyStore) Stats() ([]*Stats, error) {
+	store, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+
+	return store.Stats()
+}
+
+// Info describes the store opened, or the fallback and why it is used,
+// an empty Info if neither could be opened
+func (s *lazyStore) Info() *Info {
+	store, err := s.get()
+	if err != nil {
+		return new(Info)
+	}
+
+	info := store.Info()
+	if s.openErr != nil {
+		info.Fallback = s.openErr.Error()
+	}
+
+	return info
+}
+
+// Close _
+func (s *lazyStore) Close() error {
+	// don't open the store only to close it
+	s.once.Do(func() {
+		s.err = errors.New("cache store is closed")
+	})
+	if s.store == nil {
+		return nil
+	}
+
+	return s.store.Close()
+}
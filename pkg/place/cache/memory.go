@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type (
+	// memoryStore keeps the entries in the memory of the process, they
+	// are lost when it exits
+	memoryStore struct {
+		mu      sync.RWMutex
+		entries map[string]*memoryEntry
+	}
+
+	memoryEntry struct {
+		data      []byte
+		expiresAt time.Time
+	}
+)
+
+// NewMemoryStore returns a store which keeps the entries in memory
+func NewMemoryStore() Store {
+	return &memoryStore{
+		entries: make(map[string]*memoryEntry),
+	}
+}
+
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// Put _
+func (s *memoryStore) Put(bucket string, key []byte, value interface{}, ttl time.Duration) error {
+	// the value is encoded so it can't be changed through the cache
+	data, err := msgpack.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	e := &memoryEntry{data: data}
+	if ttl > 0 {
+		e.expiresAt = time.Now().Add(ttl)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[string(entryKey(bucket, key))] = e
+
+	return nil
+}
+
+// Get _
+func (s *memoryStore) Get(bucket string, key []byte, v interface{}) error {
+	s.mu.RLock()
+	e, ok := s.entries[string(entryKey(bucket, key))]
+	s.mu.RUnlock()
+
+	if !ok || e.expired(time.Now()) {
+		return ErrNotFound
+	}
+
+	return msgpack.Unmarshal(e.data, v)
+}
+
+// Delete _
+func (s *memoryStore) Delete(bucket string, key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, string(entryKey(bucket, key)))
+
+	return nil
+}
+
+// DropPrefix _
+func (s *memoryStore) DropPrefix(bucket string, prefix []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if bucket == "" {
+		s.entries = make(map[string]*memoryEntry)
+
+		return nil
+	}
+
+	p := string(append(bucketPrefix(bucket), prefix...))
+	for k := range s.entries {
+		if strings.HasPrefix(k, p) {
+			delete(s.entries, k)
+		}
+	}
+
+	return nil
+}
+
+// Iterate _
+func (s *memoryStore) Iterate(bucket string, fn func(e *Entry) error) error {
+	// fn is called without the lock, it may change the store
+	s.mu.RLock()
+	now := time.Now()
+	entries := make([]*Entry, 0, len(s.entries))
+	for k, me := range s.entries {
+		if me.expired(now) {
+			continue
+		}
+
+		b, key, ok := splitEntryKey([]byte(k))
+		if !ok || (bucket != "" && b != bucket) {
+			continue
+		}
+
+		entries = append(entries, &Entry{
+			Bucket:    b,
+			Key:       key,
+			Size:      int64(len(me.data)),
+			ExpiresAt: me.expiresAt,
+		})
+	}
+	s.mu.RUnlock()
+
+	sortEntries(entries)
+
+	for _, e := range entries {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Stats _
+func (s *memoryStore) Stats() ([]*Stats, error) {
+	return collectStats(s)
+}
+
+// Info _
+func (s *memoryStore) Info() *Info {
+	return &Info{Backend: BackendMemory}
+}
+
+// Close _
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+// sortEntries sorts the entries in key order, like badger iterates them
+func sortEntries(entries []*Entry) {
+	sort.Slice(entries, func(a, b int) bool {
+		return bytes.Compare(entryKey(entries[a].Bucket, entries[a].Key), entryKey(entries[b].Bucket, entries[b].Key)) < 0
+	})
+}
@@ -0,0 +1,12 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore(), func() {
+		time.Sleep(2 * testTTL)
+	})
+}
@@ -0,0 +1,336 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	defaultRedisURL = "redis://localhost:6379/0"
+	// redisNamespace prefixes the keys of the entries, so the database
+	// can be shared with other applications
+	redisNamespace = "honey:"
+	// redisSaltKey is the key of the salt of the encryption key, out of
+	// the namespace so it isn't purged with the entries
+	redisSaltKey = "honey-salt"
+	// redisPendingSaltKey is the key of the new salt of rotate-key until
+	// all the values are encrypted with its key
+	redisPendingSaltKey = redisSaltKey + pendingSuffix
+	// redisScanCount is the number of keys asked for by every SCAN
+	redisScanCount = 1000
+)
+
+// redisStore keeps the entries in redis, so several hosts, like the
+// replicas of honey serve, share them
+type redisStore struct {
+	client *redis.Client
+	sealer *sealer
+}
+
+// NewRedisStore returns the store of the redis server of the url,
+// redis://localhost:6379/0 if it is empty, whose values are encrypted
+// with key if it isn't empty. The connection is made on first use.
+func NewRedisStore(rawURL string, key []byte) (Store, error) {
+	return newRedisStore(rawURL, key)
+}
+
+func newRedisStore(rawURL string, key []byte) (*redisStore, error) {
+	if rawURL == "" {
+		rawURL = defaultRedisURL
+	}
+
+	opt, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid redis url")
+	}
+
+	sealer, err := newSealer(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &redisStore{
+		client: redis.NewClient(opt),
+		sealer: sealer,
+	}, nil
+}
+
+// rotateRedisKey encrypts the values of the redis store with newKey
+// instead of oldKey, the unencrypted ones too, keeping their ttl
+func rotateRedisKey(rawURL string, oldKey, newKey []byte) error {
+	s, err := newRedisStore(rawURL, oldKey)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if s.sealer, err = s.sealer.migrating(newKey); err != nil {
+		return err
+	}
+
+	to, err := newSealer(newKey)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	return s.scan(ctx, redisNamespace+"*", func(keys []string) error {
+		for _, k := range keys {
+			data, err := s.client.Get(ctx, k).Bytes()
+			if err == redis.Nil {
+				continue
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if data, err = s.sealer.open(data); err != nil {
+				return err
+			}
+
+			if data, err = to.seal(data); err != nil {
+				return err
+			}
+
+			// only replace the value, the key keeps its ttl
+			if err := s.client.SetArgs(ctx, k, data, redis.SetArgs{KeepTTL: true, Mode: "XX"}).Err(); err != nil && err != redis.Nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// readRedisSalt returns the salt saved in the key of the redis server
+// of the url, a new one is saved if there is none
+func readRedisSalt(rawURL string, key string) ([]byte, error) {
+	s, err := newRedisStore(rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	salt, err := newSalt()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+
+	// another process may save one meanwhile, its salt is used then
+	if err := s.client.SetNX(ctx, key, salt, 0).Err(); err != nil {
+		return nil, err
+	}
+
+	return s.client.Get(ctx, key).Bytes()
+}
+
+// savedRedisSalt returns true if a salt is saved in the key of the
+// redis server of the url
+func savedRedisSalt(rawURL string, key string) (bool, error) {
+	s, err := newRedisStore(rawURL, nil)
+	if err != nil {
+		return false, err
+	}
+	defer s.Close()
+
+	n, err := s.client.Exists(context.Background(), key).Result()
+
+	return n > 0, err
+}
+
+// renameRedisSalt replaces the salt saved in the key to of the redis
+// server of the url by the one of the key from
+func renameRedisSalt(rawURL string, from, to string) error {
+	s, err := newRedisStore(rawURL, nil)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	return s.client.Rename(context.Background(), from, to).Err()
+}
+
+func redisKey(bucket string, key []byte) string {
+	return redisNamespace + string(entryKey(bucket, key))
+}
+
+// Put _
+func (s *redisStore) Put(bucket string, key []byte, value interface{}, ttl time.Duration) error {
+	data, err := msgpack.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	if data, err = s.sealer.seal(data); err != nil {
+		return err
+	}
+
+	return s.client.Set(context.Background(), redisKey(bucket, key), data, ttl).Err()
+}
+
+// Get _
+func (s *redisStore) Get(bucket string, key []byte, v interface{}) error {
+	data, err := s.client.Get(context.Background(), redisKey(bucket, key)).Bytes()
+	if err == redis.Nil {
+		return ErrNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if data, err = s.sealer.open(data); err != nil {
+		return err
+	}
+
+	return msgpack.Unmarshal(data, v)
+}
+
+// Delete _
+func (s *redisStore) Delete(bucket string, key []byte) error {
+	return s.client.Del(context.Background(), redisKey(bucket, key)).Err()
+}
+
+// DropPrefix deletes the matching keys of the namespace only, the rest
+// of the database is left alone
+func (s *redisStore) DropPrefix(bucket string, prefix []byte) error {
+	ctx := context.Background()
+	pattern := redisNamespace + "*"
+	if bucket != "" {
+		pattern = escapeGlob(redisNamespace+string(bucketPrefix(bucket))+string(prefix)) + "*"
+	}
+
+	return s.scan(ctx, pattern, func(keys []string) error {
+		return s.client.Del(ctx, keys...).Err()
+	})
+}
+
+// Iterate _
+func (s *redisStore) Iterate(bucket string, fn func(e *Entry) error) error {
+	ctx := context.Background()
+	pattern := redisNamespace + "*"
+	if bucket != "" {
+		pattern = escapeGlob(redisNamespace+string(bucketPrefix(bucket))) + "*"
+	}
+
+	now := time.Now()
+	entries := make([]*Entry, 0)
+	if err := s.scan(ctx, pattern, func(keys []string) error {
+		pipe := s.client.Pipeline()
+		ttls := make([]*redis.DurationCmd, len(keys))
+		sizes := make([]*redis.IntCmd, len(keys))
+		for n, k := range keys {
+			ttls[n] = pipe.PTTL(ctx, k)
+			sizes[n] = pipe.StrLen(ctx, k)
+		}
+
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return err
+		}
+
+		for n, k := range keys {
+			b, key, ok := splitEntryKey([]byte(strings.TrimPrefix(k, redisNamespace)))
+			if !ok {
+				continue
+			}
+
+			ttl := ttls[n].Val()
+			// -2 is a key which expired since it was scanned
+			if ttl == -2 {
+				continue
+			}
+
+			e := &Entry{
+				Bucket: b,
+				Key:    key,
+				Size:   sizes[n].Val(),
+			}
+
+			if ttl > 0 {
+				e.ExpiresAt = now.Add(ttl)
+			}
+
+			entries = append(entries, e)
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	sortEntries(entries)
+
+	for _, e := range entries {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Stats _
+func (s *redisStore) Stats() ([]*Stats, error) {
+	return collectStats(s)
+}
+
+// Info _
+func (s *redisStore) Info() *Info {
+	return &Info{
+		Backend:   BackendRedis,
+		Location:  s.client.Options().Addr,
+		Encrypted: s.sealer != nil,
+	}
+}
+
+// Close _
+func (s *redisStore) Close() error {
+	return s.client.Close()
+}
+
+// scan calls fn with every batch of the keys matching pattern
+func (s *redisStore) scan(ctx context.Context, pattern string, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := s.client.Scan(ctx, cursor, pattern, redisScanCount).Result()
+		if err != nil {
+			return err
+		}
+
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+
+		if next == 0 {
+			return nil
+		}
+
+		cursor = next
+	}
+}
+
+// escapeGlob escapes the glob-style pattern characters of SCAN MATCH
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedisStore(t *testing.T) {
+	for name, key := range map[string][]byte{
+		"plain":     nil,
+		"encrypted": bytes.Repeat([]byte{1}, 32),
+	} {
+		t.Run(name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+
+			s, err := NewRedisStore("redis://"+mr.Addr(), key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			testStore(t, s, func() {
+				mr.FastForward(2 * testTTL)
+			})
+
+			if key != nil {
+				// unencrypted values are a miss
+				if err := mr.Set(redisKey("aws", []byte("planted")), "\x81\xa4Name\xa7planted"); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := s.Get("aws", []byte("planted"), new(testValue)); !errors.Is(err, ErrNotFound) {
+					t.Errorf("got %v for an unencrypted value, want ErrNotFound", err)
+				}
+			}
+
+			// the other keys of the database are left alone
+			if err := mr.Set("other", "value"); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := s.DropPrefix("", nil); err != nil {
+				t.Fatal(err)
+			}
+
+			if !mr.Exists("other") {
+				t.Error("a key out of the namespace was dropped")
+			}
+		})
+	}
+}
+
+func TestRedisRotateKey(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	testRotateKey(t, Options{Backend: BackendRedis, RedisURL: "redis://" + mr.Addr()})
+}
@@ -1,29 +1,121 @@
 package cache
 
 import (
+	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
-	"github.com/dgraph-io/badger/v3"
 	"github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
-	"github.com/vmihailenco/msgpack/v5"
 )
 
+// Store backends
+const (
+	BackendBadger = "badger"
+	BackendMemory = "memory"
+	BackendFile   = "file"
+	BackendRedis  = "redis"
+)
+
+// pendingSuffix is the suffix of the new salt of RotateKey, it is kept
+// next to the salt until the entries are encrypted with its key
+const pendingSuffix = ".new"
+
 var (
+	// Backends are the store backends NewStore knows
+	Backends = []string{BackendBadger, BackendMemory, BackendFile, BackendRedis}
+
+	// ErrNotFound is returned by Get if the key has no entry or it
+	// expired
+	ErrNotFound = errors.New("cache entry not found")
+
 	emptyKey = []byte("emptyCacheKey")
+	// separator separates the bucket from the key, config section
+	// names can't contain it
+	separator = []byte("/")
 )
 
 type (
-	// Store _
-	Store struct {
-		db *badger.DB
+	// Store is the cache of the backends results. The entries are kept
+	// in buckets, the config sections of the backends.
+	Store interface {
+		// Put stores the value of the key, for ttl if it isn't 0
+		Put(bucket string, key []byte, value interface{}, ttl time.Duration) error
+		// Get decodes the value of the key into v, ErrNotFound if the
+		// key has no entry
+		Get(bucket string, key []byte, v interface{}) error
+		// Delete deletes the entry of the key
+		Delete(bucket string, key []byte) error
+		// DropPrefix deletes the entries of the bucket whose key starts
+		// with prefix, all the entries of the store if bucket is empty
+		DropPrefix(bucket string, prefix []byte) error
+		// Iterate calls fn with the entries of the bucket, of all the
+		// buckets if bucket is empty, in key order. Expired entries are
+		// skipped.
+		Iterate(bucket string, fn func(e *Entry) error) error
+		// Stats returns the stats of every bucket, sorted by bucket
+		Stats() ([]*Stats, error)
+		// Info describes the store
+		Info() *Info
+		Close() error
+	}
+
+	// Info describes a store
+	Info struct {
+		Backend string
+		// Location is the directory or the server of the entries
+		Location  string
+		Encrypted bool
+		// Fallback is why the store configured couldn't be opened, empty
+		// if it is the one used
+		Fallback string
+	}
+
+	// Options selects the store backend and where it keeps the entries
+	Options struct {
+		// Backend is one of Backends, badger if empty
+		Backend string
+		// Dir is the directory of the badger and file stores, a
+		// directory under ~/.cache if empty
+		Dir string
+		// RedisURL is the redis://[:password@]host[:port][/db] of the
+		// redis store
+		RedisURL string
+		// Password encrypts the entries if it isn't empty, with a key
+		// derived from it and the random salt saved next to the store,
+		// see KeyFromPassword. The memory store isn't encrypted, it
+		// isn't kept at rest.
+		Password string
+	}
+
+	// Entry is a cache entry, the value isn't read
+	Entry struct {
+		Bucket string
+		Key    []byte
+		// Size is the estimated size of the entry on disk
+		Size int64
+		// ExpiresAt is zero if the entry never expires
+		ExpiresAt time.Time
+	}
+
+	// Stats are the stats of the entries of a bucket
+	Stats struct {
+		Bucket  string
+		Entries int
+		Size    int64
+		// MinTTL and MaxTTL are the remaining TTLs of the entries which
+		// expire first and last, zero if they never expire
+		MinTTL time.Duration
+		MaxTTL time.Duration
 	}
 )
 
 // MustNewStore create new store
-func MustNewStore() *Store {
-	s, err := NewStore()
+func MustNewStore(opt *Options) Store {
+	s, err := NewStore(opt)
 	if err != nil {
 		logrus.Fatal(err)
 	}
@@ -31,67 +123,315 @@ func MustNewStore() *Store {
 	return s
 }
 
-// NewStore _
-func NewStore() (*Store, error) {
-	home, err := homedir.Dir()
-	if err != nil {
-		return nil, err
+// NewStore returns the store of the backend of opt. The stores connect
+// or open their files on first use, so the commands which don't use the
+// cache don't lock it, nor derive its key.
+func NewStore(opt *Options) (Store, error) {
+	if !isBackend(opt.Backend) {
+		return nil, unknownBackend(opt.Backend)
 	}
 
-	opt := badger.DefaultOptions(filepath.Join(home, ".cache", "honey-cachedb"))
-	opt.Logger = &logger{logrus.WithField("where", "store")}
-	db, err := badger.Open(opt)
-	if err != nil {
-		return nil, err
+	if opt.Password == "" || opt.Backend == BackendMemory {
+		return newStore(opt, nil)
 	}
 
-	return &Store{
-		db: db,
+	return &lazyStore{
+		open: func() (Store, error) {
+			key, err := storeKey(opt)
+			if err != nil {
+				return nil, errors.Wrap(err, "can't derive the cache encryption key")
+			}
+
+			return newStore(opt, key)
+		},
 	}, nil
 }
 
-// Close _
-func (s *Store) Close() error {
-	return s.db.Close()
-}
+// newStore returns the store of the backend of opt encrypted with key
+func newStore(opt *Options, key []byte) (Store, error) {
+	switch opt.Backend {
+	case "", BackendBadger:
+		dir, err := optionsDir(opt)
+		if err != nil {
+			return nil, err
+		}
 
-// Put _
-func (s *Store) Put(bucket string, key []byte, value interface{}, ttl time.Duration) error {
-	if err := s.db.Update(func(txn *badger.Txn) error {
-		data, err := msgpack.Marshal(value)
+		return NewBadgerStore(dir, key)
+	case BackendMemory:
+		return NewMemoryStore(), nil
+	case BackendFile:
+		dir, err := optionsDir(opt)
 		if err != nil {
+			return nil, err
+		}
+
+		return NewFileStore(dir, key)
+	case BackendRedis:
+		return NewRedisStore(opt.RedisURL, key)
+	}
+
+	return nil, unknownBackend(opt.Backend)
+}
+
+// RotateKey encrypts the store of opt, whose Password is the current
+// one, with newPassword and a new salt. The store must not be in use.
+//
+// The new salt is saved as pending and replaces the salt of the store
+// once all the entries are encrypted with its key only. A rotation which
+// failed, or was interrupted, is resumed by the next one with the same
+// new password, the entries already encrypted with its key are kept.
+func RotateKey(opt *Options, newPassword string) error {
+	if newPassword == "" {
+		return errors.New("the new cache password is empty")
+	}
+
+	if !isBackend(opt.Backend) {
+		return unknownBackend(opt.Backend)
+	}
+
+	if opt.Backend == BackendMemory {
+		return nil
+	}
+
+	var oldKey []byte
+	if opt.Password != "" {
+		var err error
+		if oldKey, err = storeKey(opt); err != nil {
 			return err
 		}
+	}
 
-		e := badger.NewEntry(append([]byte(bucket), cacheKeyName(key)...), data).WithTTL(ttl)
-		return txn.SetEntry(e)
-	}); err != nil {
+	salt, resumed, err := readPendingSalt(opt)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	if resumed {
+		logrus.Infof("resuming the interrupted rotation of the cache key, the new password must be the same")
+	}
+
+	newKey, err := KeyFromPassword(newPassword, salt)
+	if err != nil {
+		return err
+	}
+
+	if err := rotateStore(opt, oldKey, newKey); err != nil {
+		return err
+	}
+
+	return commitSalt(opt)
 }
 
-// Get _
-func (s *Store) Get(bucket string, key []byte, v interface{}) error {
-	var value []byte
+// rotateStore encrypts the entries of the store of opt with newKey
+// instead of oldKey
+func rotateStore(opt *Options, oldKey, newKey []byte) error {
+	switch opt.Backend {
+	case "", BackendBadger:
+		dir, err := optionsDir(opt)
+		if err != nil {
+			return err
+		}
+
+		if err := rotateBadgerKey(dir, oldKey, newKey); err != nil {
+			return err
+		}
 
-	if err := s.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get(append([]byte(bucket), key...))
+		// the entries cached while the database was locked
+		return rotateFileKey(dir+"-files", oldKey, newKey)
+	case BackendFile:
+		dir, err := optionsDir(opt)
 		if err != nil {
 			return err
 		}
 
-		return item.Value(func(val []byte) error {
-			value = append([]byte{}, val...)
+		return rotateFileKey(dir, oldKey, newKey)
+	case BackendRedis:
+		return rotateRedisKey(opt.RedisURL, oldKey, newKey)
+	}
 
-			return nil
-		})
-	}); err != nil {
+	return nil
+}
+
+// storeKey returns the encryption key of the store of opt
+func storeKey(opt *Options) ([]byte, error) {
+	salt, err := readSalt(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	return KeyFromPassword(opt.Password, salt)
+}
+
+// readSalt returns the salt of the store of opt, a new one is saved if
+// it has none
+func readSalt(opt *Options) ([]byte, error) {
+	if opt.Backend == BackendRedis {
+		return readRedisSalt(opt.RedisURL, redisSaltKey)
+	}
+
+	path, err := saltPath(opt)
+	if err != nil {
+		return nil, err
+	}
+
+	return readSaltFile(path)
+}
+
+// readPendingSalt returns the new salt of the rotation of the key of the
+// store of opt, resumed is true if it was saved by a previous rotation
+func readPendingSalt(opt *Options) (salt []byte, resumed bool, err error) {
+	if opt.Backend == BackendRedis {
+		if resumed, err = savedRedisSalt(opt.RedisURL, redisPendingSaltKey); err != nil {
+			return nil, false, err
+		}
+
+		salt, err = readRedisSalt(opt.RedisURL, redisPendingSaltKey)
+
+		return salt, resumed, err
+	}
+
+	path, err := saltPath(opt)
+	if err != nil {
+		return nil, false, err
+	}
+
+	path += pendingSuffix
+	if resumed, err = savedSalt(path); err != nil {
+		return nil, false, err
+	}
+
+	salt, err = readSaltFile(path)
+
+	return salt, resumed, err
+}
+
+// commitSalt replaces the salt of the store of opt by the new salt of
+// the rotation of its key
+func commitSalt(opt *Options) error {
+	if opt.Backend == BackendRedis {
+		return renameRedisSalt(opt.RedisURL, redisPendingSaltKey, redisSaltKey)
+	}
+
+	path, err := saltPath(opt)
+	if err != nil {
 		return err
 	}
 
-	return msgpack.Unmarshal(value, v)
+	return os.Rename(path+pendingSuffix, path)
+}
+
+// saltPath returns the salt file of the badger and file stores, next to
+// their directory
+func saltPath(opt *Options) (string, error) {
+	dir, err := optionsDir(opt)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Clean(dir) + ".salt", nil
+}
+
+// optionsDir returns the directory of the badger or file store of opt
+func optionsDir(opt *Options) (string, error) {
+	if opt.Backend == BackendFile {
+		return storeDir(opt.Dir, "honey-cache")
+	}
+
+	return storeDir(opt.Dir, "honey-cachedb")
+}
+
+func isBackend(backend string) bool {
+	if backend == "" {
+		return true
+	}
+
+	for _, b := range Backends {
+		if b == backend {
+			return true
+		}
+	}
+
+	return false
+}
+
+func unknownBackend(backend string) error {
+	return errors.Errorf("unknown cache backend %q, must be one of %s", backend, strings.Join(Backends, "|"))
+}
+
+// storeDir returns dir, or the directory name under ~/.cache if it is
+// empty
+func storeDir(dir, name string) (string, error) {
+	if dir != "" {
+		return homedir.Expand(dir)
+	}
+
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".cache", name), nil
+}
+
+// collectStats returns the stats of the entries of every bucket of s
+func collectStats(s Store) ([]*Stats, error) {
+	buckets := make(map[string]*Stats)
+	now := time.Now()
+	if err := s.Iterate("", func(e *Entry) error {
+		st, ok := buckets[e.Bucket]
+		if !ok {
+			st = &Stats{Bucket: e.Bucket}
+			buckets[e.Bucket] = st
+		}
+
+		st.Entries++
+		st.Size += e.Size
+
+		if !e.ExpiresAt.IsZero() {
+			ttl := e.ExpiresAt.Sub(now)
+			if st.MinTTL == 0 || ttl < st.MinTTL {
+				st.MinTTL = ttl
+			}
+
+			if ttl > st.MaxTTL {
+				st.MaxTTL = ttl
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	stats := make([]*Stats, 0, len(buckets))
+	for _, st := range buckets {
+		stats = append(stats, st)
+	}
+
+	sort.Slice(stats, func(a, b int) bool {
+		return stats[a].Bucket < stats[b].Bucket
+	})
+
+	return stats, nil
+}
+
+func bucketPrefix(bucket string) []byte {
+	return append([]byte(bucket), separator...)
+}
+
+func entryKey(bucket string, key []byte) []byte {
+	return append(bucketPrefix(bucket), cacheKeyName(key)...)
+}
+
+// splitEntryKey returns the bucket and the key of an entry key, ok is
+// false if it has no bucket
+func splitEntryKey(k []byte) (bucket string, key []byte, ok bool) {
+	i := strings.Index(string(k), string(separator))
+	if i < 0 {
+		return "", nil, false
+	}
+
+	return string(k[:i]), k[i+len(separator):], true
 }
 
 func cacheKeyName(key []byte) []byte {
@@ -0,0 +1,276 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testTTL is the ttl of the entries which expire in the tests
+const testTTL = 100 * time.Millisecond
+
+type testValue struct {
+	Name string
+}
+
+// testStore runs the tests every store must pass, expire makes the
+// entries put with testTTL expire
+func testStore(t *testing.T, s Store, expire func()) {
+	put := func(bucket, key string, ttl time.Duration) {
+		t.Helper()
+
+		if err := s.Put(bucket, []byte(key), &testValue{Name: bucket + "/" + key}, ttl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys := func(bucket string) []string {
+		t.Helper()
+
+		found := make([]string, 0)
+		if err := s.Iterate(bucket, func(e *Entry) error {
+			found = append(found, e.Bucket+"/"+string(e.Key))
+
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		return found
+	}
+
+	reset := func() {
+		t.Helper()
+
+		if err := s.DropPrefix("", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("PutGet", func(t *testing.T) {
+		reset()
+		put("aws", "api", 0)
+		put("aws", "", 0)
+
+		for _, key := range []string{"api", ""} {
+			v := new(testValue)
+			if err := s.Get("aws", []byte(key), v); err != nil {
+				t.Fatal(err)
+			}
+
+			if v.Name != "aws/"+key {
+				t.Errorf("got %q, want %q", v.Name, "aws/"+key)
+			}
+		}
+
+		if err := s.Get("gcp", []byte("api"), new(testValue)); !errors.Is(err, ErrNotFound) {
+			t.Errorf("got %v for the key of another bucket, want ErrNotFound", err)
+		}
+
+		if err := s.Delete("aws", []byte("api")); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := s.Get("aws", []byte("api"), new(testValue)); !errors.Is(err, ErrNotFound) {
+			t.Errorf("got %v for a deleted key, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("TTL", func(t *testing.T) {
+		reset()
+		put("aws", "short", testTTL)
+		put("aws", "long", 0)
+
+		if err := s.Get("aws", []byte("short"), new(testValue)); err != nil {
+			t.Fatalf("got %v before the entry expired", err)
+		}
+
+		expire()
+
+		if err := s.Get("aws", []byte("short"), new(testValue)); !errors.Is(err, ErrNotFound) {
+			t.Errorf("got %v for an expired key, want ErrNotFound", err)
+		}
+
+		if got := keys("aws"); len(got) != 1 || got[0] != "aws/long" {
+			t.Errorf("iterated %v, want the entries which didn't expire", got)
+		}
+	})
+
+	t.Run("Iterate", func(t *testing.T) {
+		reset()
+		put("gcp", "c", 0)
+		put("aws", "b", time.Hour)
+		put("aws", "a", 0)
+
+		if got := keys("aws"); len(got) != 2 || got[0] != "aws/a" || got[1] != "aws/b" {
+			t.Errorf("iterated %v, want aws/a aws/b", got)
+		}
+
+		if got := keys(""); len(got) != 3 || got[0] != "aws/a" || got[1] != "aws/b" || got[2] != "gcp/c" {
+			t.Errorf("iterated %v, want aws/a aws/b gcp/c", got)
+		}
+
+		if err := s.Iterate("aws", func(e *Entry) error {
+			if expires := !e.ExpiresAt.IsZero(); expires != bytes.Equal(e.Key, []byte("b")) {
+				t.Errorf("%s expires at %v", e.Key, e.ExpiresAt)
+			}
+
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("DropPrefix", func(t *testing.T) {
+		reset()
+		put("aws", "api-1", 0)
+		put("aws", "api-2", 0)
+		put("aws", "db", 0)
+		put("gcp", "api", 0)
+
+		if err := s.DropPrefix("aws", []byte("api")); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := keys(""); len(got) != 2 || got[0] != "aws/db" || got[1] != "gcp/api" {
+			t.Errorf("got %v after dropping aws/api, want aws/db gcp/api", got)
+		}
+
+		if err := s.DropPrefix("aws", nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := keys(""); len(got) != 1 || got[0] != "gcp/api" {
+			t.Errorf("got %v after dropping aws, want gcp/api", got)
+		}
+
+		reset()
+
+		if got := keys(""); len(got) != 0 {
+			t.Errorf("got %v after dropping everything", got)
+		}
+	})
+}
+
+func TestStoreKeySalt(t *testing.T) {
+	dir := t.TempDir()
+	opt := &Options{Backend: BackendFile, Dir: filepath.Join(dir, "cache"), Password: "secret"}
+
+	key, err := storeKey(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := storeKey(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(key, again) {
+		t.Error("the key of the store changed")
+	}
+
+	other, err := storeKey(&Options{Backend: BackendFile, Dir: filepath.Join(dir, "other"), Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Equal(key, other) {
+		t.Error("the stores of the same password have the same key")
+	}
+}
+
+// testRotateKey encrypts the store of opt, which has an entry, with a
+// password, rotates it to another one, after an interrupted rotation,
+// and checks the entry can only be read with the current password
+func testRotateKey(t *testing.T, opt Options) {
+	with := func(password string) *Options {
+		o := opt
+		o.Password = password
+
+		return &o
+	}
+
+	get := func(password string) (string, error) {
+		t.Helper()
+
+		s, err := NewStore(with(password))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		v := new(testValue)
+		err = s.Get("aws", []byte("api"), v)
+
+		return v.Name, err
+	}
+
+	s, err := NewStore(with(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Put("aws", []byte("api"), &testValue{Name: "api"}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RotateKey(with(""), "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	if name, err := get("secret"); err != nil || name != "api" {
+		t.Fatalf("got %q, %v with the password, want the entry", name, err)
+	}
+
+	if _, err := get(""); err == nil {
+		t.Error("the entry was read without the password")
+	}
+
+	// a rotation interrupted once the entries were encrypted, before its
+	// salt replaced the one of the store
+	oldKey, err := storeKey(with("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	salt, _, err := readPendingSalt(with("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newKey, err := KeyFromPassword("other", salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rotateStore(with("secret"), oldKey, newKey); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RotateKey(with("secret"), "other"); err != nil {
+		t.Fatalf("can't resume the rotation: %v", err)
+	}
+
+	if name, err := get("other"); err != nil || name != "api" {
+		t.Fatalf("got %q, %v with the new password, want the entry", name, err)
+	}
+
+	if _, err := get("secret"); err == nil {
+		t.Error("the entry was read with the old password")
+	}
+}
+
+func TestRotateKey(t *testing.T) {
+	for _, backend := range []string{BackendBadger, BackendFile} {
+		t.Run(backend, func(t *testing.T) {
+			testRotateKey(t, Options{Backend: backend, Dir: filepath.Join(t.TempDir(), "cache")})
+		})
+	}
+}
@@ -7,6 +7,8 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/rclone/rclone/fs"
+
+	"github.com/bringg/honey/pkg/place/query"
 )
 
 // Global
@@ -32,11 +34,31 @@ var (
 type (
 	// ConfigInfo is honey config options
 	ConfigInfo struct {
-		NoCache        bool
-		NoColor        bool
-		OutFormat      string
-		BackendsString string
-		CacheTTL       time.Duration
+		NoCache          bool
+		NoColor          bool
+		NoHeaders        bool
+		OutFormat        string
+		BackendsString   string
+		CacheTTL         time.Duration
+		StaleTTL         time.Duration
+		NegativeCacheTTL time.Duration
+		CacheBackend     string
+		CacheDir         string
+		CacheRedisURL    string
+		CacheEncrypt     bool
+		Offline          bool
+		SyncInterval     time.Duration
+		IndexDir         string
+		FromSnapshot     string
+		Timeout          time.Duration
+		MatchMode        string
+		IgnoreCase       bool
+		MaxConcurrency   int
+		Merge            string
+		SortBy           string
+		Reverse          bool
+		GroupBy          string
+		Limit            int
 	}
 )
 
@@ -44,7 +66,11 @@ func NewConfig() *ConfigInfo {
 	c := new(ConfigInfo)
 
 	c.OutFormat = "table"
+	c.MatchMode = string(query.MatchSubstring)
+	c.MaxConcurrency = 16
 	c.CacheTTL = 600 * time.Second // Set ttl = 600 , after 600 seconds, cache key will be expired.
+	c.CacheBackend = "badger"
+	c.SyncInterval = time.Hour
 
 	return c
 }
@@ -75,6 +101,50 @@ func (c *ConfigInfo) Backends() ([]string, error) {
 	return backends, nil
 }
 
+// PatternMatcher returns the matcher of the free text pattern for the
+// match mode of the config in ctx
+func PatternMatcher(ctx context.Context, pattern string) (*query.Matcher, error) {
+	ci := GetConfig(ctx)
+
+	return query.NewMatcher(pattern, query.MatchMode(ci.MatchMode), ci.IgnoreCase)
+}
+
+// PatternMatchers returns the matchers of the free text patterns of a
+// search of several filters, see query.Query.Patterns, or the matcher
+// of its single pattern
+func PatternMatchers(ctx context.Context, q *query.Query) ([]*query.Matcher, error) {
+	patterns := q.Patterns
+	if len(patterns) == 0 {
+		patterns = []string{q.Pattern}
+	}
+
+	matchers := make([]*query.Matcher, 0, len(patterns))
+	for _, pattern := range patterns {
+		m, err := PatternMatcher(ctx, pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		matchers = append(matchers, m)
+	}
+
+	return matchers, nil
+}
+
+// MatchedPatterns returns the patterns of the matchers for which match
+// is true, the instances of a search of several filters are tagged
+// with them
+func MatchedPatterns(matchers []*query.Matcher, match func(m *query.Matcher) bool) []string {
+	patterns := make([]string, 0)
+	for _, m := range matchers {
+		if match(m) {
+			patterns = append(patterns, m.Pattern)
+		}
+	}
+
+	return patterns
+}
+
 // AddConfig returns a mutable config structure based on a shallow
 // copy of that found in ctx and returns a new context with that added
 // to it.
@@ -0,0 +1,112 @@
+package place
+
+import (
+	"strings"
+
+	"github.com/bringg/honey/pkg/place/query"
+)
+
+// Change types
+const (
+	ChangeAdded   ChangeType = "added"
+	ChangeRemoved ChangeType = "removed"
+	ChangeUpdated ChangeType = "changed"
+)
+
+// DiffLabels compares all the labels of the instances, labels.<key>
+// compares a single one
+const DiffLabels = "labels"
+
+var (
+	// DiffFields are the fields compared between two searches of the
+	// same instances
+	DiffFields = []string{query.FieldStatus, query.FieldPrivateIP, query.FieldPublicIP}
+
+	// InventoryDiffFields are the fields compared between two
+	// inventories by honey diff, unless set
+	InventoryDiffFields = []string{query.FieldStatus, query.FieldPrivateIP, query.FieldPublicIP, query.FieldType, DiffLabels}
+)
+
+type (
+	// ChangeType is how an instance changed between two searches
+	ChangeType string
+
+	// FieldChange is the previous and the current value of a field
+	FieldChange struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+
+	// Change is an instance added, removed or changed between two
+	// searches, Instance is the previous one if it was removed
+	Change struct {
+		Type     ChangeType
+		Instance *Instance
+		Fields   map[string]*FieldChange
+	}
+)
+
+// Key returns the key the instance is identified by across searches,
+// the id is only unique within a backend
+func (i *Instance) Key() string {
+	return i.BackendName + "/" + i.ID
+}
+
+// Diff returns the changes of the DiffFields of the instances since the
+// previous search, see DiffOn
+func (p Printable) Diff(prev Printable) []*Change {
+	return p.DiffOn(prev, DiffFields)
+}
+
+// DiffOn returns the changes of the fields of the instances since the
+// previous search, in the order of the instances and the removed ones
+// last. Every instance is added if prev is nil. The fields are those of
+// Values, or DiffLabels.
+func (p Printable) DiffOn(prev Printable, diffFields []string) []*Change {
+	prevByKey := make(map[string]*Instance, len(prev))
+	for _, i := range prev {
+		prevByKey[i.Key()] = i
+	}
+
+	changes := make([]*Change, 0)
+	seen := make(map[string]struct{}, len(p))
+	for _, i := range p {
+		seen[i.Key()] = struct{}{}
+
+		old, ok := prevByKey[i.Key()]
+		if !ok {
+			changes = append(changes, &Change{Type: ChangeAdded, Instance: i})
+
+			continue
+		}
+
+		fields := make(map[string]*FieldChange)
+		for _, field := range diffFields {
+			from, to := old.diffValue(field), i.diffValue(field)
+			if from != to {
+				fields[field] = &FieldChange{From: from, To: to}
+			}
+		}
+
+		if len(fields) > 0 {
+			changes = append(changes, &Change{Type: ChangeUpdated, Instance: i, Fields: fields})
+		}
+	}
+
+	for _, i := range prev {
+		if _, ok := seen[i.Key()]; !ok {
+			changes = append(changes, &Change{Type: ChangeRemoved, Instance: i})
+		}
+	}
+
+	return changes
+}
+
+// diffValue returns the value of the field compared by DiffOn
+func (i *Instance) diffValue(field string) string {
+	if field == DiffLabels {
+		return FormatLabels(i.Labels)
+	}
+
+	return strings.Join(i.Values(field), ",")
+}
@@ -0,0 +1,142 @@
+package place
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const maxRetries = 8
+
+var (
+	// minBackoff and maxBackoff bound the wait before a throttled call
+	// is retried
+	minBackoff = 500 * time.Millisecond
+	maxBackoff = 30 * time.Second
+
+	// limiters are the rate limiters of the backends by config section,
+	// they are shared by all the searches of the process
+	limiters   = make(map[string]*Limiter)
+	limitersMu sync.Mutex
+
+	// calls bounds the API calls running at once over all the backends
+	calls     chan struct{}
+	callsOnce sync.Once
+)
+
+type (
+	// Limiter paces the API calls of a backend config section to its
+	// qps and burst options
+	Limiter struct {
+		rate  *rate.Limiter
+		qps   float64
+		burst int
+	}
+
+	limiterContextKeyType struct{}
+)
+
+// Context key for the limiter
+var limiterContextKey = limiterContextKeyType{}
+
+// GetLimiter returns the shared limiter of the backend config section
+func GetLimiter(name string, opt *CommonOptions) *Limiter {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+
+	l, ok := limiters[name]
+	if ok && l.qps == opt.QPS && l.burst == opt.Burst {
+		return l
+	}
+
+	l = &Limiter{
+		rate:  rate.NewLimiter(rate.Inf, 0),
+		qps:   opt.QPS,
+		burst: opt.Burst,
+	}
+
+	if opt.QPS > 0 {
+		burst := opt.Burst
+		if burst <= 0 {
+			burst = int(math.Ceil(opt.QPS))
+		}
+
+		l.rate = rate.NewLimiter(rate.Limit(opt.QPS), burst)
+	}
+
+	limiters[name] = l
+
+	return l
+}
+
+// AddLimiter returns a new context with the limiter of the backend
+// config section added to it, Call uses it to pace the API calls
+func AddLimiter(ctx context.Context, name string, opt *CommonOptions) context.Context {
+	return context.WithValue(ctx, limiterContextKey, GetLimiter(name, opt))
+}
+
+// Call runs the API call fn within the rate of the backend limiter in
+// ctx, once a slot of --max-concurrency is free. A throttled call,
+// as told by isThrottled, is retried with an exponential backoff
+// instead of failing the search.
+func Call(ctx context.Context, isThrottled func(err error) bool, fn func() error) error {
+	l, _ := ctx.Value(limiterContextKey).(*Limiter)
+
+	backoff := minBackoff
+	for retry := 0; ; retry++ {
+		err := call(ctx, l, fn)
+		if err == nil || isThrottled == nil || !isThrottled(err) || retry == maxRetries {
+			return err
+		}
+
+		log.Debugf("throttled, retrying in %s: %v", backoff, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// call waits for the rate of the limiter before taking a slot of
+// --max-concurrency, so a slow backend doesn't hold the slots of the
+// other ones while it waits
+func call(ctx context.Context, l *Limiter, fn func() error) error {
+	if l != nil {
+		if err := l.rate.Wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	sem := concurrency(ctx)
+	if sem != nil {
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return fn()
+}
+
+// concurrency returns the semaphore of --max-concurrency, nil if the
+// calls aren't limited
+func concurrency(ctx context.Context) chan struct{} {
+	callsOnce.Do(func() {
+		if n := GetConfig(ctx).MaxConcurrency; n > 0 {
+			calls = make(chan struct{}, n)
+		}
+	})
+
+	return calls
+}
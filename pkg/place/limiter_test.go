@@ -0,0 +1,149 @@
+package place
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errThrottled = errors.New("rate exceeded")
+
+func isTestThrottled(err error) bool {
+	return errors.Is(err, errThrottled)
+}
+
+// useTestBackoff shortens the backoff of the throttled calls for the test
+func useTestBackoff(t *testing.T, min, max time.Duration) {
+	minB, maxB := minBackoff, maxBackoff
+	minBackoff, maxBackoff = min, max
+
+	t.Cleanup(func() {
+		minBackoff, maxBackoff = minB, maxB
+	})
+}
+
+func TestCallRetriesThrottled(t *testing.T) {
+	useTestBackoff(t, 20*time.Millisecond, time.Second)
+
+	calls := 0
+	start := time.Now()
+	err := Call(context.Background(), isTestThrottled, func() error {
+		if calls++; calls < 3 {
+			return errThrottled
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 3 {
+		t.Errorf("called %d times, want 3", calls)
+	}
+
+	// 20ms then 40ms
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("retried within %s, want an exponential backoff", elapsed)
+	}
+}
+
+func TestCallGivesUp(t *testing.T) {
+	useTestBackoff(t, time.Millisecond, 2*time.Millisecond)
+
+	calls := 0
+	err := Call(context.Background(), isTestThrottled, func() error {
+		calls++
+
+		return errThrottled
+	})
+	if !errors.Is(err, errThrottled) {
+		t.Errorf("got %v, want the throttling error", err)
+	}
+
+	if calls != maxRetries+1 {
+		t.Errorf("called %d times, want %d", calls, maxRetries+1)
+	}
+
+	// the other errors aren't retried
+	calls = 0
+	errDenied := errors.New("denied")
+	if err := Call(context.Background(), isTestThrottled, func() error {
+		calls++
+
+		return errDenied
+	}); err != errDenied || calls != 1 {
+		t.Errorf("got %v after %d calls, want denied once", err, calls)
+	}
+
+	calls = 0
+	if err := Call(context.Background(), nil, func() error {
+		calls++
+
+		return errThrottled
+	}); err != errThrottled || calls != 1 {
+		t.Errorf("got %v after %d calls, want no retry without isThrottled", err, calls)
+	}
+}
+
+func TestCallBackoffCancelled(t *testing.T) {
+	useTestBackoff(t, time.Minute, time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := Call(ctx, isTestThrottled, func() error {
+		return errThrottled
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the deadline exceeded", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("waited %s, want the backoff given up with the context", elapsed)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	opt := &CommonOptions{QPS: 20, Burst: 1}
+	name := t.Name()
+
+	l := GetLimiter(name, opt)
+	if GetLimiter(name, &CommonOptions{QPS: 20, Burst: 1}) != l {
+		t.Error("got a new limiter for the same options, want it shared")
+	}
+
+	if GetLimiter(name, &CommonOptions{QPS: 10}) == l {
+		t.Error("got the same limiter for new options")
+	}
+
+	ctx := AddLimiter(context.Background(), name, opt)
+
+	start := time.Now()
+	for n := 0; n < 3; n++ {
+		if err := Call(ctx, nil, func() error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the first call is in the burst, the others wait 50ms each
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("3 calls took %s, want them paced at 20 qps", elapsed)
+	}
+
+	// without qps the calls aren't paced
+	ctx = AddLimiter(context.Background(), name+"-unlimited", &CommonOptions{})
+
+	start = time.Now()
+	for n := 0; n < 100; n++ {
+		if err := Call(ctx, nil, func() error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("100 calls took %s, want them not paced", elapsed)
+	}
+}
@@ -0,0 +1,293 @@
+package place
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rclone/rclone/fs"
+)
+
+// Merge rules, the instance fields correlated to find the same host
+const (
+	MergeID   = "id"
+	MergeIP   = "ip"
+	MergeName = "name"
+)
+
+// MergeRules is the list of the supported merge rules
+var MergeRules = []string{MergeID, MergeIP, MergeName}
+
+// ParseMergeRules parses the comma separated merge rules
+func ParseMergeRules(s string) ([]string, error) {
+	rules := fs.CommaSepList{}
+	if err := rules.Set(s); err != nil {
+		return nil, err
+	}
+
+	for i, rule := range rules {
+		rule = strings.ToLower(strings.TrimSpace(rule))
+		if rule != MergeID && rule != MergeIP && rule != MergeName {
+			return nil, errors.Errorf("unknown merge rule %q, use any of %v", rule, MergeRules)
+		}
+
+		rules[i] = rule
+	}
+
+	return rules, nil
+}
+
+// Merge correlates the instances which are the same host, e.g. an EC2
+// instance, the Consul node with its private ip and the k8s pods which
+// host ip it is. Instances are the same if they share the id, an ip
+// address or, across backends, a name which is unique in its backend.
+//
+// The same private ip is often used by several accounts, so instances of
+// the same backend type share an ip only in the same account. Instances
+// of other types share it only if it is in a single account of every
+// type. types are the backend types of the backend names, the backend
+// name is its type if it has none.
+//
+// Every merged host is a single instance, its Sources are the
+// `backend_name/id` of the instances it was made of and its raw data is
+// the list of their raw data, in the same order.
+func (p Printable) Merge(rules []string, types map[string]string) Printable {
+	parent := make([]int, len(p))
+	for i := range parent {
+		parent[i] = i
+	}
+
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+
+		return parent[i]
+	}
+
+	names := make(map[string]int)
+	for _, i := range p {
+		names[i.BackendName+"/"+strings.ToLower(i.Name)]++
+	}
+
+	union := func(a, b int) {
+		parent[find(a)] = find(b)
+	}
+
+	seen := make(map[string]int)
+	ips := make(map[string][]int)
+	for idx, i := range p {
+		for _, key := range mergeKeys(i, rules, names) {
+			if strings.HasPrefix(key, "ip:") {
+				ips[key] = append(ips[key], idx)
+
+				continue
+			}
+
+			if other, ok := seen[key]; ok {
+				union(idx, other)
+
+				continue
+			}
+
+			seen[key] = idx
+		}
+	}
+
+	for _, shared := range ips {
+		mergeIP(p, shared, types, union)
+	}
+
+	// keep the order in which the hosts were first found
+	groups := make(map[int]Printable)
+	roots := make([]int, 0)
+	for idx, i := range p {
+		root := find(idx)
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+
+		groups[root] = append(groups[root], i)
+	}
+
+	merged := make(Printable, 0, len(roots))
+	for _, root := range roots {
+		merged = append(merged, mergeGroup(groups[root]))
+	}
+
+	return merged
+}
+
+// mergeKeys returns the correlation keys of the instance for the rules
+func mergeKeys(i *Instance, rules []string, names map[string]int) []string {
+	keys := make([]string, 0)
+	for _, rule := range rules {
+		switch rule {
+		case MergeID:
+			if i.ID != "" {
+				keys = append(keys, "id:"+i.ID)
+			}
+		case MergeIP:
+			for _, ip := range []string{i.PrivateIP, i.PublicIP} {
+				if ip != "" {
+					keys = append(keys, "ip:"+ip)
+				}
+			}
+		case MergeName:
+			// e.g. all the instances of an auto scaling group share the name
+			name := strings.ToLower(i.Name)
+			if name != "" && names[i.BackendName+"/"+name] == 1 {
+				keys = append(keys, "name:"+name)
+			}
+		}
+	}
+
+	return keys
+}
+
+// mergeIP unions the instances which share an ip address, the ones of
+// the same backend type if they are in the same account and the ones of
+// other types if the ip isn't in several accounts of a type
+func mergeIP(p Printable, shared []int, types map[string]string, union func(a, b int)) {
+	typeOf := func(i *Instance) string {
+		if t, ok := types[i.BackendName]; ok {
+			return t
+		}
+
+		return i.BackendName
+	}
+
+	first := make(map[string]int)
+	accounts := make(map[string][]string)
+	for _, idx := range shared {
+		i := p[idx]
+		t := typeOf(i)
+
+		key := t + "/" + i.Account
+		if other, ok := first[key]; ok {
+			union(idx, other)
+
+			continue
+		}
+
+		first[key] = idx
+		accounts[t] = append(accounts[t], i.Account)
+	}
+
+	for _, list := range accounts {
+		if len(list) > 1 {
+			return
+		}
+	}
+
+	for _, idx := range shared[1:] {
+		union(idx, shared[0])
+	}
+}
+
+// mergeGroup merges the instances of a host, the model is the one of
+// the host itself, the empty fields are filled from the others
+func mergeGroup(group Printable) *Instance {
+	sort.SliceStable(group, func(a, b int) bool {
+		sa, sb := mergeScore(group[a], group), mergeScore(group[b], group)
+		if sa != sb {
+			return sa > sb
+		}
+
+		if group[a].BackendName != group[b].BackendName {
+			return group[a].BackendName < group[b].BackendName
+		}
+
+		return group[a].ID < group[b].ID
+	})
+
+	merged := &Instance{Model: group[0].Model}
+	merged.Labels = make(map[string]string)
+	merged.Sources = make([]string, 0, len(group))
+	merged.Patterns = nil
+
+	raws := make([]interface{}, 0, len(group))
+	backends := make([]string, 0)
+	for _, i := range group {
+		merged.Sources = append(merged.Sources, i.BackendName+"/"+i.ID)
+		raws = append(raws, i.Raw)
+
+		if !contains(backends, i.BackendName) {
+			backends = append(backends, i.BackendName)
+		}
+
+		for _, f := range []struct{ to, from *string }{
+			{&merged.PrivateIP, &i.PrivateIP},
+			{&merged.PublicIP, &i.PublicIP},
+			{&merged.Region, &i.Region},
+			{&merged.Zone, &i.Zone},
+			{&merged.Account, &i.Account},
+		} {
+			if *f.to == "" {
+				*f.to = *f.from
+			}
+		}
+
+		if merged.CreatedAt == nil {
+			merged.CreatedAt = i.CreatedAt
+		}
+
+		for _, pattern := range i.Patterns {
+			if !contains(merged.Patterns, pattern) {
+				merged.Patterns = append(merged.Patterns, pattern)
+			}
+		}
+
+		for k, v := range i.Labels {
+			if _, ok := merged.Labels[k]; !ok {
+				merged.Labels[k] = v
+			}
+		}
+	}
+
+	merged.BackendName = strings.Join(backends, ",")
+	merged.Raw = raws
+
+	return merged
+}
+
+// mergeScore ranks the instances of a host, the ones with more details
+// first and the guests, e.g. k8s pods which public ip is the private ip
+// of another instance, last
+func mergeScore(i *Instance, group Printable) int {
+	score := 0
+	for _, v := range []string{i.Name, i.Type, i.Status, i.PrivateIP, i.PublicIP, i.Region, i.Zone, i.Account} {
+		if v != "" {
+			score++
+		}
+	}
+
+	if i.CreatedAt != nil {
+		score++
+	}
+
+	if len(i.Labels) > 0 {
+		score++
+	}
+
+	for _, other := range group {
+		if other != i && i.PublicIP != "" && i.PublicIP == other.PrivateIP {
+			score -= 10
+
+			break
+		}
+	}
+
+	return score
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
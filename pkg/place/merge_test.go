@@ -0,0 +1,155 @@
+package place
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+// sources returns the sources of the merged hosts, sorted
+func sources(p Printable) []string {
+	hosts := make([]string, len(p))
+	for n, i := range p {
+		list := append([]string{}, i.Sources...)
+		sort.Strings(list)
+		hosts[n] = strings.Join(list, ",")
+	}
+
+	sort.Strings(hosts)
+
+	return hosts
+}
+
+func TestMerge(t *testing.T) {
+	types := map[string]string{"aws-prod": "aws", "aws-dev": "aws", "consul": "consul", "k8s": "k8s"}
+
+	for _, tc := range []struct {
+		name      string
+		rules     []string
+		instances Printable
+		want      []string
+	}{
+		{
+			name:  "host of several backends",
+			rules: MergeRules,
+			instances: Printable{
+				{Model: Model{ID: "i-1", BackendName: "aws-prod", Name: "api", PrivateIP: "10.0.0.1", Account: "111"}},
+				{Model: Model{ID: "node-1", BackendName: "consul", Name: "ip-10-0-0-1", PrivateIP: "10.0.0.1"}},
+				{Model: Model{ID: "pod-1", BackendName: "k8s", Name: "api-7d9", PrivateIP: "172.16.0.5", PublicIP: "10.0.0.1", Account: "prod"}},
+				{Model: Model{ID: "i-2", BackendName: "aws-prod", Name: "db", PrivateIP: "10.0.0.2", Account: "111"}},
+			},
+			want: []string{"aws-prod/i-1,consul/node-1,k8s/pod-1", "aws-prod/i-2"},
+		},
+		{
+			name:  "same ip in the accounts of a backend type",
+			rules: []string{MergeIP},
+			instances: Printable{
+				{Model: Model{ID: "i-1", BackendName: "aws-prod", PrivateIP: "10.0.0.1", Account: "111"}},
+				{Model: Model{ID: "i-2", BackendName: "aws-dev", PrivateIP: "10.0.0.1", Account: "222"}},
+			},
+			want: []string{"aws-dev/i-2", "aws-prod/i-1"},
+		},
+		{
+			name:  "ambiguous ip across backend types",
+			rules: []string{MergeIP},
+			instances: Printable{
+				{Model: Model{ID: "i-1", BackendName: "aws-prod", PrivateIP: "10.0.0.1", Account: "111"}},
+				{Model: Model{ID: "i-2", BackendName: "aws-dev", PrivateIP: "10.0.0.1", Account: "222"}},
+				{Model: Model{ID: "node-1", BackendName: "consul", PrivateIP: "10.0.0.1"}},
+			},
+			want: []string{"aws-dev/i-2", "aws-prod/i-1", "consul/node-1"},
+		},
+		{
+			name:  "same ip in the same account",
+			rules: []string{MergeIP},
+			instances: Printable{
+				{Model: Model{ID: "pod-1", BackendName: "k8s", PublicIP: "10.0.0.1", Account: "prod"}},
+				{Model: Model{ID: "pod-2", BackendName: "k8s", PublicIP: "10.0.0.1", Account: "prod"}},
+			},
+			want: []string{"k8s/pod-1,k8s/pod-2"},
+		},
+		{
+			name:  "transitive",
+			rules: []string{MergeID, MergeIP},
+			instances: Printable{
+				{Model: Model{ID: "i-1", BackendName: "aws-prod", PrivateIP: "10.0.0.1", Account: "111"}},
+				{Model: Model{ID: "node-1", BackendName: "consul", PrivateIP: "10.0.0.1", PublicIP: "54.0.0.1"}},
+				{Model: Model{ID: "pod-1", BackendName: "k8s", PublicIP: "54.0.0.1"}},
+				{Model: Model{ID: "i-1", BackendName: "aws-dev", Account: "222"}},
+			},
+			want: []string{"aws-dev/i-1,aws-prod/i-1,consul/node-1,k8s/pod-1"},
+		},
+		{
+			name:  "names unique in their backend",
+			rules: []string{MergeName},
+			instances: Printable{
+				{Model: Model{ID: "i-1", BackendName: "aws-prod", Name: "API"}},
+				{Model: Model{ID: "node-1", BackendName: "consul", Name: "api"}},
+				{Model: Model{ID: "i-2", BackendName: "aws-prod", Name: "web"}},
+				{Model: Model{ID: "i-3", BackendName: "aws-prod", Name: "web"}},
+				{Model: Model{ID: "node-2", BackendName: "consul", Name: "web"}},
+			},
+			want: []string{"aws-prod/i-1,consul/node-1", "aws-prod/i-2", "aws-prod/i-3", "consul/node-2"},
+		},
+		{
+			name:  "rules not used",
+			rules: []string{MergeID},
+			instances: Printable{
+				{Model: Model{ID: "i-1", BackendName: "aws-prod", Name: "api", PrivateIP: "10.0.0.1"}},
+				{Model: Model{ID: "node-1", BackendName: "consul", Name: "api", PrivateIP: "10.0.0.1"}},
+			},
+			want: []string{"aws-prod/i-1", "consul/node-1"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := sources(tc.instances.Merge(tc.rules, types))
+			if strings.Join(got, " ") != strings.Join(tc.want, " ") {
+				t.Errorf("merged %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMergeGroup(t *testing.T) {
+	p := Printable{
+		{Model: Model{ID: "pod-1", BackendName: "k8s", Name: "api-7d9", PrivateIP: "172.16.0.5", PublicIP: "10.0.0.1", Patterns: []string{"api"}}, Raw: "pod"},
+		{Model: Model{ID: "i-1", BackendName: "aws", Name: "api", Type: "t3.micro", PrivateIP: "10.0.0.1", Region: "us-east-1", Patterns: []string{"10.0.0.1"}}, Raw: "ec2"},
+	}
+
+	merged := p.Merge([]string{MergeIP}, nil)
+	if len(merged) != 1 {
+		t.Fatalf("got %d hosts, want 1", len(merged))
+	}
+
+	host := merged[0]
+	if host.ID != "i-1" || host.BackendName != "aws,k8s" {
+		t.Errorf("got host %s of %s, want i-1 of aws,k8s", host.ID, host.BackendName)
+	}
+
+	if strings.Join(host.Sources, " ") != "aws/i-1 k8s/pod-1" {
+		t.Errorf("got sources %v, want the ec2 instance first", host.Sources)
+	}
+
+	if raws, ok := host.Raw.([]interface{}); !ok || len(raws) != 2 || raws[0] != "ec2" {
+		t.Errorf("got raw %v, want the raw data in the sources order", host.Raw)
+	}
+
+	if strings.Join(host.Patterns, " ") != "10.0.0.1 api" {
+		t.Errorf("got patterns %v, want both", host.Patterns)
+	}
+}
+
+func TestParseMergeRules(t *testing.T) {
+	rules, err := ParseMergeRules("IP, id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(rules, ",") != "ip,id" {
+		t.Errorf("got %v, want [ip id]", rules)
+	}
+
+	if _, err := ParseMergeRules("ip,mac"); err == nil {
+		t.Error("parsed the unknown rule mac")
+	}
+}
@@ -0,0 +1,113 @@
+package operations
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/bringg/honey/pkg/place"
+	"github.com/bringg/honey/pkg/place/query"
+)
+
+// Inventory returns the instances of the backends in the snapshot of
+// path, or searched live if path is empty, for honey diff. The backends
+// which aren't in the snapshot are skipped. Without filters every
+// instance is listed, from the index of honey sync with --offline.
+func Inventory(ctx context.Context, path string, backendNames []string, filters []string) (*Result, error) {
+	if path != "" {
+		var ci *place.ConfigInfo
+		ctx, ci = place.AddConfig(ctx)
+		ci.FromSnapshot, ci.Offline = path, false
+
+		snapshotted, err := SnapshotBackends(path)
+		if err != nil {
+			return nil, err
+		}
+
+		backendNames = intersect(backendNames, snapshotted)
+	}
+
+	ci := place.GetConfig(ctx)
+	switch {
+	case len(filters) > 0:
+		return Find(ctx, backendNames, filters)
+	case ci.FromSnapshot != "" || ci.Offline:
+		return Indexed(ctx, backendNames)
+	}
+
+	return listAll(ctx, backendNames)
+}
+
+// listAll lists every instance of the backends in parallel
+func listAll(ctx context.Context, backendNames []string) (*Result, error) {
+	infos := make(map[string]*place.RegInfo, len(backendNames))
+	for _, bucketName := range backendNames {
+		info, err := findInfo(bucketName)
+		if err != nil {
+			return nil, err
+		}
+
+		infos[bucketName] = info
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		backendsE BackendErrors
+		ages      = make(map[string]*DataAge)
+	)
+
+	instances := new(ConcurrentSlice)
+
+	for bucketName, info := range infos {
+		wg.Add(1)
+
+		go func(bucketName string, info *place.RegInfo) {
+			defer wg.Done()
+
+			age, err := findBackend(ctx, info, bucketName, new(query.Query), instances.Append)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				backendsE = append(backendsE, err)
+
+				return
+			}
+
+			ages[bucketName] = age
+		}(bucketName, info)
+	}
+
+	wg.Wait()
+
+	sort.Sort(backendsE)
+
+	return &Result{
+		Instances: instances.Items,
+		Errors:    backendsE,
+		Ages:      ages,
+	}, nil
+}
+
+// intersect returns the names which are in others, in order
+func intersect(names []string, others []string) []string {
+	in := make(map[string]struct{}, len(others))
+	for _, name := range others {
+		in[name] = struct{}{}
+	}
+
+	kept := make([]string, 0, len(names))
+	for _, name := range names {
+		if _, ok := in[name]; ok {
+			kept = append(kept, name)
+
+			continue
+		}
+
+		log.Debugf("backend %s isn't in the snapshot, skipped", name)
+	}
+
+	return kept
+}
@@ -0,0 +1,40 @@
+package operations
+
+import (
+	"testing"
+
+	"github.com/bringg/honey/pkg/place"
+)
+
+func TestDiffSnapshotWithLive(t *testing.T) {
+	fields := append(append([]string{}, place.InventoryDiffFields...), "labels.CostCenter", "raw.instance_type", "raw.placement.availability_zone")
+
+	live := testInstances()
+	snapshot := roundTrip(t, testInstances())
+
+	if changes := live.DiffOn(snapshot, fields); len(changes) != 0 {
+		for _, c := range changes {
+			t.Errorf("unexpected %s %s: %v", c.Type, c.Instance.Key(), c.Fields)
+		}
+	}
+
+	live[0].Labels["CostCenter"] = "y"
+	live[1].Status = "running"
+
+	changes := live.DiffOn(snapshot, fields)
+	if len(changes) != 2 {
+		t.Fatalf("got %d changes, want 2", len(changes))
+	}
+
+	if fc := changes[0].Fields["labels"]; fc == nil || fc.From != "CostCenter=x,Name=api" || fc.To != "CostCenter=y,Name=api" {
+		t.Errorf("labels change = %+v", fc)
+	}
+
+	if fc := changes[0].Fields["labels.CostCenter"]; fc == nil || fc.From != "x" || fc.To != "y" {
+		t.Errorf("labels.CostCenter change = %+v", fc)
+	}
+
+	if fc := changes[1].Fields["status"]; fc == nil || fc.From != "stopped" || fc.To != "running" {
+		t.Errorf("status change = %+v", fc)
+	}
+}
@@ -2,19 +2,25 @@ package operations
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/sirupsen/logrus"
-	"golang.org/x/sync/errgroup"
 
 	"github.com/bringg/honey/pkg/place"
 	"github.com/bringg/honey/pkg/place/cache"
+	"github.com/bringg/honey/pkg/place/query"
 )
 
 var (
-	log     = logrus.WithField("operation", "Find")
-	CacheDB = cache.MustNewStore()
+	log = logrus.WithField("operation", "Find")
+	// CacheDB is the cache of the backends results, the commands set the
+	// one of --cache-backend once the flags are parsed
+	CacheDB cache.Store = cache.NewMemoryStore()
 )
 
 type (
@@ -22,8 +28,58 @@ type (
 		sync.RWMutex
 		Items place.Printable
 	}
+
+	// BackendError is the error of a single backend which failed to answer
+	BackendError struct {
+		Backend  string
+		Err      error
+		TimedOut bool
+	}
+
+	// BackendErrors is a list of backend errors, sorted by backend name
+	BackendErrors []*BackendError
+
+	// Result holds the instances found and the errors of the backends
+	// which failed, so partial results can still be used
+	Result struct {
+		Instances place.Printable
+		Errors    BackendErrors
+		// Ages are the ages of the data of the backends which answered
+		Ages map[string]*DataAge
+	}
+
+	// DataAge is how old the instances of a backend are
+	DataAge struct {
+		FetchedAt time.Time
+		// Cached is true if the instances were taken from the cache
+		Cached bool
+		// Stale is true if the cache entry expired, or is about to, and
+		// is refreshed in the background
+		Stale bool
+	}
+
+	// cachedList is the cache entry of a backend search
+	cachedList struct {
+		FetchedAt time.Time
+		Instances place.Printable
+	}
+
+	// cachePolicy is how the results of a backend are cached, the
+	// options of its section win over the global flags
+	cachePolicy struct {
+		// NoCache skips the cache lookup, Disabled the cache altogether
+		NoCache     bool
+		Disabled    bool
+		TTL         time.Duration
+		StaleTTL    time.Duration
+		NegativeTTL time.Duration
+	}
 )
 
+// staleAfter is the part of the cache TTL after which an entry is
+// refreshed in the background, if stale entries can be served
+const staleAfter = 0.8
+
 func (cs *ConcurrentSlice) Append(item place.Printable) {
 	cs.Lock()
 	defer cs.Unlock()
@@ -31,81 +87,504 @@ func (cs *ConcurrentSlice) Append(item place.Printable) {
 	cs.Items = append(cs.Items, item...)
 }
 
-// Find _
-func Find(ctx context.Context, backendNames []string, pattern string) (place.Printable, error) {
-	if pattern == "" {
-		return nil, errors.New("filter text is missing")
+// Age returns the age of the data
+func (a *DataAge) Age() time.Duration {
+	return time.Since(a.FetchedAt)
+}
+
+// String returns the age of the data, live if it wasn't cached
+func (a *DataAge) String() string {
+	if !a.Cached {
+		return "live"
 	}
 
-	backends := make(map[string]place.Backend)
+	s := a.Age().Round(time.Second).String() + " old"
+	if a.Stale {
+		s += ", refreshing"
+	}
 
-	instances := new(ConcurrentSlice)
-	ci := place.GetConfig(ctx)
+	return s
+}
 
-	for _, name := range backendNames {
-		bucketName := name
+// newCachePolicy returns the cache policy of the backend of opt
+func newCachePolicy(ci *place.ConfigInfo, opt *place.CommonOptions) *cachePolicy {
+	p := &cachePolicy{
+		NoCache:     ci.NoCache,
+		Disabled:    opt.NoCache,
+		TTL:         ci.CacheTTL,
+		StaleTTL:    ci.StaleTTL,
+		NegativeTTL: ci.NegativeCacheTTL,
+	}
 
-		m := place.ConfigMap(nil, name)
-		if bName, ok := m.Get("type"); ok {
-			name = bName
+	if opt.CacheTTL > 0 {
+		p.TTL = time.Duration(opt.CacheTTL)
+	}
+
+	if opt.NegativeCacheTTL > 0 {
+		p.NegativeTTL = time.Duration(opt.NegativeCacheTTL)
+	}
+
+	return p
+}
+
+// ttl returns how long the entry is kept, 0 if it must not be cached.
+// Searches which found nothing are cached for the negative ttl only,
+// they aren't served stale.
+func (p *cachePolicy) ttl(e *cachedList) time.Duration {
+	if len(e.Instances) == 0 {
+		return p.NegativeTTL
+	}
+
+	return p.TTL + p.StaleTTL
+}
+
+// usable returns true if the entry can be served, it may be stale
+func (e *cachedList) usable(p *cachePolicy) bool {
+	return time.Since(e.FetchedAt) < p.ttl(e)
+}
+
+// stale returns true if the entry must be refreshed
+func (e *cachedList) stale(p *cachePolicy) bool {
+	return p.StaleTTL > 0 && len(e.Instances) > 0 && time.Since(e.FetchedAt) >= time.Duration(float64(p.TTL)*staleAfter)
+}
+
+// Error implements the error interface
+func (e *BackendError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Backend, e.Err)
+}
+
+// Unwrap returns the original backend error
+func (e *BackendError) Unwrap() error {
+	return e.Err
+}
+
+func (e BackendErrors) Len() int           { return len(e) }
+func (e BackendErrors) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e BackendErrors) Less(i, j int) bool { return e[i].Backend < e[j].Backend }
+
+// Find searches all the backends in parallel. A backend which fails
+// or doesn't answer in time doesn't fail the search, its error is
+// returned in Result.Errors next to the instances found by the other
+// backends.
+//
+// Every filter is parsed as a query, see the query package, the terms
+// a backend can't push down are evaluated here. Several filters are
+// ORed, every backend is listed once for all of them and the instances
+// are tagged with the filters they match.
+//
+// Fuzzy matches, see query.MatchFuzzy, are ranked by score across all
+// the backends unless sorted by a path, and --limit keeps the first
+// instances only.
+func Find(ctx context.Context, backendNames []string, filters []string) (*Result, error) {
+	return FindStream(ctx, backendNames, filters, nil)
+}
+
+// FindStream is like Find but it also sends the instances on out as
+// they are found, page by page for the backends which implement
+// place.Streamer. The Result holds all the instances sent. out, if not
+// nil, is closed when FindStream returns and must be drained by the
+// caller. Merged, sorted or grouped instances are not streamed, only
+// returned.
+func FindStream(ctx context.Context, backendNames []string, filters []string, out chan<- place.Printable) (*Result, error) {
+	if out != nil {
+		defer close(out)
+	}
+
+	patterns, err := parsePatterns(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	ci := place.GetConfig(ctx)
+
+	var mergeRules []string
+	if ci.Merge != "" {
+		if mergeRules, err = place.ParseMergeRules(ci.Merge); err != nil {
+			return nil, err
 		}
+	}
 
-		info, err := place.Find(name)
+	// fuzzy matches are ordered by how well they match
+	ranked := patterns[0].matcher.Mode == query.MatchFuzzy
+
+	// the hosts and the order are known once all the backends answered
+	if ci.Merge != "" || ci.SortBy != "" || ci.GroupBy != "" || ranked || ci.Limit > 0 {
+		out = nil
+	}
+
+	infos := make(map[string]*place.RegInfo)
+	searches := make(map[string]*search)
+	for _, bucketName := range backendNames {
+		info, err := searchInfo(ci, bucketName)
 		if err != nil {
 			return nil, err
 		}
 
-		backend, err := info.NewBackend(ctx, place.ConfigMap(info, bucketName))
-		if err != nil {
-			return nil, errors.Wrap(err, name)
+		// skip the backends excluded by all the patterns
+		s := newSearch(patterns, bucketName, info.Name)
+		if s == nil {
+			log.Debugf("backend %s excluded by query", bucketName)
+
+			continue
 		}
 
-		// try to take from cache
-		if !ci.NoCache {
-			ins := make(place.Printable, 0)
-			if err := CacheDB.Get(bucketName, []byte(backend.CacheKeyName(pattern)), &ins); err == nil {
-				log.Debugf("using cache: %s, provider %s, pattern `%s`, found: %d items", bucketName, name, pattern, len(ins))
+		infos[bucketName] = info
+		searches[bucketName] = s
+	}
 
-				instances.Append(ins)
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		backendsE BackendErrors
+		ages      = make(map[string]*DataAge)
+	)
 
-				continue
-			}
+	instances := new(ConcurrentSlice)
+
+	for bucketName, info := range infos {
+		wg.Add(1)
+
+		go func(bucketName string, info *place.RegInfo, s *search) {
+			defer wg.Done()
+
+			age, err := findBackend(ctx, info, bucketName, s.query, func(page place.Printable) {
+				page = s.tag(page)
+				if len(page) == 0 {
+					return
+				}
+
+				instances.Append(page)
+				if out != nil {
+					out <- page
+				}
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
 
 			if err != nil {
-				log.Debug(err)
+				log.Debugf("backend %s failed: %v", bucketName, err)
+
+				backendsE = append(backendsE, err)
+
+				return
 			}
+
+			ages[bucketName] = age
+		}(bucketName, info, searches[bucketName])
+	}
+
+	wg.Wait()
+
+	sort.Sort(backendsE)
+
+	if mergeRules != nil {
+		types := make(map[string]string, len(infos))
+		for bucketName, info := range infos {
+			types[bucketName] = info.Name
 		}
 
-		backends[bucketName] = backend
+		instances.Items = instances.Items.Merge(mergeRules, types)
 	}
 
-	g, fCtx := errgroup.WithContext(ctx)
+	instances.Items.SortBy(ci.SortBy, ci.Reverse)
+	if ranked && ci.SortBy == "" {
+		matchers := make([]*query.Matcher, len(patterns))
+		for n, p := range patterns {
+			matchers[n] = p.matcher
+		}
 
-	for bucketName, b := range backends {
-		g.Go(func(bucketName string, backend place.Backend) func() error {
-			return func() error {
-				ins, err := backend.List(fCtx, bucketName, pattern)
-				if err != nil {
-					return errors.Wrap(err, b.Name())
-				}
+		instances.Items.Rank(matchers)
+	}
 
-				log.Debugf("using backend: %s, provider %s, pattern `%s`, found: %d items", bucketName, backend.Name(), pattern, len(ins))
+	if ci.Limit > 0 && len(instances.Items) > ci.Limit {
+		instances.Items = instances.Items[:ci.Limit]
+	}
 
-				// store to cache
-				if err := CacheDB.Put(bucketName, []byte(backend.CacheKeyName(pattern)), ins, ci.CacheTTL); err != nil {
-					log.Debugf("can't store cache for (%s) backend: %v", bucketName, err)
-				}
+	return &Result{
+		Instances: instances.Items,
+		Errors:    backendsE,
+		Ages:      ages,
+	}, nil
+}
+
+// findInfo returns the registry info of the backend type of the config
+// section, the section name is the type if it has none
+func findInfo(bucketName string) (*place.RegInfo, error) {
+	name := bucketName
+	if bName, ok := place.ConfigMap(nil, bucketName).Get("type"); ok {
+		name = bName
+	}
+
+	return place.Find(name)
+}
+
+// searchInfo returns the registry info of the backend searched, the
+// backends of --from-snapshot needn't be configured
+func searchInfo(ci *place.ConfigInfo, bucketName string) (*place.RegInfo, error) {
+	if ci.FromSnapshot != "" {
+		return snapshotInfo(ci.FromSnapshot, bucketName)
+	}
+
+	return findInfo(bucketName)
+}
 
-				instances.Append(ins)
+// findBackend searches a single backend within its deadline, the per
+// backend timeout option wins over the global one. The pages found are
+// passed to emit, the ones found before a timeout are kept.
+func findBackend(ctx context.Context, info *place.RegInfo, bucketName string, q *query.Query, emit func(place.Printable)) (*DataAge, *BackendError) {
+	ci := place.GetConfig(ctx)
+	m := place.ConfigMap(info, bucketName)
+
+	opt, err := place.GetCommonOptions(m)
+	if err != nil {
+		return nil, &BackendError{Backend: bucketName, Err: err}
+	}
+
+	timeout := ci.Timeout
+	if opt.Timeout > 0 {
+		timeout = time.Duration(opt.Timeout)
+	}
+
+	// pace the API calls of the backend with the shared limiter
+	ctx = place.AddLimiter(ctx, bucketName, opt)
 
-				return nil
+	// the backend must stop sending pages once we stop receiving them
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	// not every client honours the context, so don't wait for the
+	// backend past its deadline
+	var age *DataAge
+	pages := make(chan place.Printable)
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		age, err = listBackend(ctx, newCachePolicy(ci, opt), info, m, bucketName, q, pages)
+		done <- err
+	}()
+
+	for {
+		select {
+		case page := <-pages:
+			emit(page)
+		case err := <-done:
+			// pages are sent unbuffered, all of them were received
+			if err == nil {
+				return age, nil
 			}
-		}(bucketName, b))
+
+			return nil, backendError(ctx, bucketName, timeout, err)
+		case <-ctx.Done():
+			return nil, backendError(ctx, bucketName, timeout, ctx.Err())
+		}
+	}
+}
+
+// backendError returns the error of the backend, or a timeout error if
+// its deadline was exceeded
+func backendError(ctx context.Context, bucketName string, timeout time.Duration, err error) *BackendError {
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &BackendError{Backend: bucketName, Err: err}
+	}
+
+	return &BackendError{
+		Backend:  bucketName,
+		Err:      errors.Errorf("timed out after %s", timeout),
+		TimedOut: true,
+	}
+}
+
+// listBackend lists a single backend, using the cache or the index of
+// honey sync if possible, and sends the pages matching the query terms
+// on pages. Only complete results are cached. With a stale TTL, an expired or about to expire
+// cache entry is served and refreshed in the background, see OnStale.
+func listBackend(ctx context.Context, policy *cachePolicy, info *place.RegInfo, m configmap.Mapper, bucketName string, q *query.Query, pages chan<- place.Printable) (*DataAge, error) {
+	ci := place.GetConfig(ctx)
+
+	matcher, err := place.PatternMatcher(ctx, q.Pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	// fuzzy matches can't be pushed down, the backend lists all the
+	// instances, sharing the cached list of the other searches, and they
+	// are matched here
+	var fuzzy *query.Matcher
+	if matcher.Mode == query.MatchFuzzy {
+		var lci *place.ConfigInfo
+		ctx, lci = place.AddConfig(ctx)
+		lci.MatchMode = string(query.MatchSubstring)
+
+		fuzzy, q = matcher, &query.Query{Terms: q.Terms}
+		if matcher, err = place.PatternMatcher(ctx, q.Pattern); err != nil {
+			return nil, err
+		}
+	}
+
+	match := func(page place.Printable) place.Printable {
+		page = page.Match(q.Terms)
+		if fuzzy == nil {
+			return page
+		}
+
+		matched := make(place.Printable, 0, len(page))
+		for _, i := range page {
+			if i.MatchPattern(fuzzy) {
+				matched = append(matched, i)
+			}
+		}
+
+		return matched
+	}
+
+	// the snapshot and the index of honey sync answer without calling
+	// the backend
+	if ci.FromSnapshot != "" {
+		return listSnapshot(ctx, ci.FromSnapshot, bucketName, matcher, match, pages)
+	}
+
+	if ci.Offline {
+		return listIndex(ctx, bucketName, nil, matcher, match, pages)
+	}
+
+	backend, err := info.NewBackend(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+
+	// backends which can't push down the terms only list by the pattern
+	querier, isQuerier := backend.(place.Querier)
+	streamer, isStreamer := backend.(place.Streamer)
+	if len(q.Patterns) > 0 {
+		return listPatterns(ctx, policy, info, m, bucketName, backend, q, matcher, match, pages)
+	}
+
+	key := q.Pattern
+	if isQuerier || isStreamer {
+		key = q.String()
+	}
+
+	// the match mode changes the results of the same pattern, and the
+	// config those of the same search
+	fingerprint := place.ConfigFingerprint(info, m)
+	key = fingerprint + ":" + matcher.String() + ":" + key
+
+	// the search to refresh a stale entry with
+	search := matcher.String() + ":" + q.String()
+	cacheKey := []byte(backend.CacheKeyName(key))
+
+	// try to take from cache
+	if !policy.NoCache && !policy.Disabled {
+		entry := new(cachedList)
+		err = CacheDB.Get(bucketName, cacheKey, entry)
+		if err == nil && entry.usable(policy) {
+			age := &DataAge{
+				FetchedAt: entry.FetchedAt,
+				Cached:    true,
+				Stale:     entry.stale(policy),
+			}
+
+			log.Debugf("using cache: %s, provider %s, query `%s`, found: %d items, %s", bucketName, info.Name, key, len(entry.Instances), age)
+
+			if age.Stale {
+				refreshStale(ctx, &Refresh{Backend: bucketName, Search: search})
+			}
+
+			return age, place.SendPage(ctx, pages, match(entry.Instances))
+		}
+
+		log.Debugf("no usable cache: %s, query `%s`: %v", bucketName, key, err)
+
+		// an index synced with the same config within the cache ttl is as
+		// good as a cache entry
+		if index, err := readIndex(bucketName); err == nil && index.Fingerprint == fingerprint && time.Since(index.SyncedAt) < policy.TTL {
+			return listIndex(ctx, bucketName, index, matcher, match, pages)
+		}
+	}
+
+	age := &DataAge{FetchedAt: time.Now()}
+
+	var ins place.Printable
+	switch {
+	case isStreamer:
+		ins, err = streamBackend(ctx, streamer, bucketName, q, match, pages)
+	case isQuerier:
+		ins, err = querier.ListQuery(ctx, bucketName, q)
+	default:
+		ins, err = backend.List(ctx, bucketName, q.Pattern)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("using backend: %s, provider %s, query `%s`, found: %d items", bucketName, backend.Name(), key, len(ins))
+
+	// store to cache, stale entries are kept to be served while refreshed
+	if !policy.Disabled {
+		putCache(ctx, policy, bucketName, cacheKey, &cachedList{FetchedAt: age.FetchedAt, Instances: ins})
+	}
+
+	if isStreamer {
+		return age, nil
+	}
+
+	return age, place.SendPage(ctx, pages, match(ins))
+}
+
+// putCache stores the entry for the ttl of the policy. The search of
+// the backend may be given up on while it lists, see findBackend, and
+// the cache closed, the entry isn't stored then.
+func putCache(ctx context.Context, policy *cachePolicy, bucketName string, key []byte, entry *cachedList) {
+	ttl := policy.ttl(entry)
+	if ttl <= 0 {
+		return
+	}
+
+	if err := ctx.Err(); err != nil {
+		log.Debugf("not storing cache for (%s) backend: %v", bucketName, err)
+
+		return
+	}
+
+	if err := CacheDB.Put(bucketName, key, entry, ttl); err != nil {
+		log.Debugf("can't store cache for (%s) backend: %v", bucketName, err)
+	}
+}
+
+// streamBackend sends the instances of the streamer pages which match
+// on pages as they arrive, it returns all the instances of the stream
+// for the cache
+func streamBackend(ctx context.Context, streamer place.Streamer, bucketName string, q *query.Query, match func(place.Printable) place.Printable, pages chan<- place.Printable) (place.Printable, error) {
+	raw := make(chan place.Printable)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(raw)
+
+		errc <- streamer.Stream(ctx, bucketName, q, raw)
+	}()
+
+	var sendErr error
+	ins := make(place.Printable, 0)
+	for page := range raw {
+		ins = append(ins, page...)
+
+		// keep draining the stream once the receiver is gone, the
+		// streamer stops on the canceled context
+		if sendErr == nil {
+			sendErr = place.SendPage(ctx, pages, match(page))
+		}
 	}
 
-	if err := g.Wait(); err != nil {
+	if err := <-errc; err != nil {
 		return nil, err
 	}
 
-	return instances.Items, nil
+	return ins, sendErr
 }
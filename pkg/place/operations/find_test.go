@@ -0,0 +1,608 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/config/configmap"
+
+	"github.com/bringg/honey/pkg/place"
+	"github.com/bringg/honey/pkg/place/cache"
+	"github.com/bringg/honey/pkg/place/query"
+)
+
+// testBackends is the number of the backend types registered by the tests
+var testBackends int32
+
+// testBackend is a backend of the tests which only implements List, it
+// lists its instances matching the pattern, or calls list if set
+type testBackend struct {
+	name      string
+	instances place.Printable
+	list      func(ctx context.Context) (place.Printable, error)
+	calls     int32
+	returned  int32
+}
+
+func (b *testBackend) Name() string {
+	return b.name
+}
+
+func (b *testBackend) CacheKeyName(pattern string) string {
+	return b.name + ":" + pattern
+}
+
+func (b *testBackend) List(ctx context.Context, backendName string, pattern string) (place.Printable, error) {
+	atomic.AddInt32(&b.calls, 1)
+	defer atomic.AddInt32(&b.returned, 1)
+
+	instances := b.instances
+	if b.list != nil {
+		var err error
+		if instances, err = b.list(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	m, err := place.PatternMatcher(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return matchPattern(instances, m), nil
+}
+
+// Calls returns how many times the backend was listed
+func (b *testBackend) Calls() int {
+	return int(atomic.LoadInt32(&b.calls))
+}
+
+// waitListed waits for the lists of the backend given up on by the
+// search to return, they use the cache of the test until then
+func (b *testBackend) waitListed(t *testing.T) {
+	for n := 0; n < 100; n++ {
+		if calls := atomic.LoadInt32(&b.calls); calls > 0 && atomic.LoadInt32(&b.returned) == calls {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("the lists of %s didn't return", b.name)
+}
+
+// testStreamer is a backend of the tests which sends its instances one
+// page at a time, then waits for wait if set
+type testStreamer struct {
+	*testBackend
+	wait func(ctx context.Context) error
+}
+
+func (s *testStreamer) Stream(ctx context.Context, backendName string, q *query.Query, out chan<- place.Printable) error {
+	atomic.AddInt32(&s.calls, 1)
+	defer atomic.AddInt32(&s.returned, 1)
+
+	for _, i := range s.instances {
+		if err := place.SendPage(ctx, out, place.Printable{i}); err != nil {
+			return err
+		}
+	}
+
+	if s.wait != nil {
+		return s.wait(ctx)
+	}
+
+	return nil
+}
+
+// newTestBackend registers a new backend type with the instances of
+// the names, its config section is the type
+func newTestBackend(names ...string) *testBackend {
+	b := testBackendOf(names)
+	registerTestBackend(b.name, b)
+
+	return b
+}
+
+// newTestStreamer registers a new streaming backend type with the
+// instances of the names, its config section is the type
+func newTestStreamer(names ...string) *testStreamer {
+	s := &testStreamer{testBackend: testBackendOf(names)}
+	registerTestBackend(s.name, s)
+
+	return s
+}
+
+// testBackendOf returns a backend of a new type with the instances of
+// the names
+func testBackendOf(names []string) *testBackend {
+	b := &testBackend{name: fmt.Sprintf("test%d", atomic.AddInt32(&testBackends, 1))}
+	for n, name := range names {
+		b.instances = append(b.instances, &place.Instance{Model: place.Model{
+			ID:          fmt.Sprintf("id-%d", n+1),
+			BackendName: b.name,
+			Name:        name,
+		}})
+	}
+
+	return b
+}
+
+// registerTestBackend registers the backend type of the name, it has a
+// region option
+func registerTestBackend(name string, b place.Backend) {
+	place.Register(&place.RegInfo{
+		Name: name,
+		NewBackend: func(ctx context.Context, m configmap.Mapper) (place.Backend, error) {
+			return b, nil
+		},
+		Options: []place.Option{{Name: "region", Help: "Region of the instances"}},
+	})
+}
+
+// useTestCache replaces the cache and the index by empty ones for the
+// test
+func useTestCache(t *testing.T) {
+	cacheDB, indexDB, onStale := CacheDB, IndexDB, OnStale
+	CacheDB, IndexDB, OnStale = cache.NewMemoryStore(), cache.NewMemoryStore(), nil
+
+	t.Cleanup(func() {
+		CacheDB, IndexDB, OnStale = cacheDB, indexDB, onStale
+	})
+}
+
+// names returns the names of the instances and the patterns they match
+func names(instances place.Printable) string {
+	found := make([]string, len(instances))
+	for n, i := range instances {
+		found[n] = i.Name
+		if len(i.Patterns) > 0 {
+			found[n] += "[" + strings.Join(i.Patterns, ",") + "]"
+		}
+	}
+
+	return strings.Join(found, " ")
+}
+
+func TestFindPatternsListOnly(t *testing.T) {
+	useTestCache(t)
+
+	b := newTestBackend("api", "api-db", "web")
+	ctx := context.Background()
+
+	res, err := Find(ctx, []string{b.name}, []string{"api", "db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := names(res.Instances); got != "api[api] api-db[api,db]" {
+		t.Errorf("found %s, want api[api] api-db[api,db]", got)
+	}
+
+	if b.Calls() != 2 {
+		t.Errorf("listed the backend %d times, want once per pattern", b.Calls())
+	}
+
+	// the search of a single pattern shares the cache
+	res, err = Find(ctx, []string{b.name}, []string{"db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := names(res.Instances); got != "api-db" || !res.Ages[b.name].Cached {
+		t.Errorf("found %s, cached %v, want api-db from the cache", got, res.Ages[b.name].Cached)
+	}
+
+	if b.Calls() != 2 {
+		t.Errorf("listed the backend %d times, want the cache of the patterns used", b.Calls())
+	}
+}
+
+func TestFindTimedOutBackendNotCached(t *testing.T) {
+	useTestCache(t)
+
+	// the backend doesn't honour the context
+	release, listed := make(chan struct{}), make(chan struct{})
+	b := newTestBackend("api")
+	b.list = func(ctx context.Context) (place.Printable, error) {
+		defer close(listed)
+		<-release
+
+		return b.instances, nil
+	}
+
+	ctx, ci := place.AddConfig(context.Background())
+	ci.Timeout = 50 * time.Millisecond
+
+	res, err := Find(ctx, []string{b.name}, []string{"api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Errors) != 1 || !res.Errors[0].TimedOut {
+		t.Fatalf("got errors %v, want a timeout", res.Errors)
+	}
+
+	// the cache may be closed once the search is done
+	close(release)
+	<-listed
+	b.waitListed(t)
+	time.Sleep(50 * time.Millisecond)
+
+	if stats, err := CacheDB.Stats(); err != nil || len(stats) != 0 {
+		t.Errorf("got cache stats %v, %v, want no entries", stats, err)
+	}
+}
+
+func TestFindPartialResults(t *testing.T) {
+	useTestCache(t)
+
+	ok := newTestBackend("api", "web")
+	failed := newTestBackend("api")
+	errDown := errors.New("service unavailable")
+	failed.list = func(ctx context.Context) (place.Printable, error) {
+		return nil, errDown
+	}
+
+	res, err := Find(context.Background(), []string{failed.name, ok.name}, []string{"api"})
+	if err != nil {
+		t.Fatalf("the search failed with a backend: %v", err)
+	}
+
+	if got := names(res.Instances); got != "api" {
+		t.Errorf("found %s, want the api of the backend which answered", got)
+	}
+
+	if len(res.Errors) != 1 || res.Errors[0].Backend != failed.name || !errors.Is(res.Errors[0], errDown) || res.Errors[0].TimedOut {
+		t.Fatalf("got errors %v, want the error of %s", res.Errors, failed.name)
+	}
+
+	if _, found := res.Ages[failed.name]; found {
+		t.Errorf("got the age of the failed backend")
+	}
+
+	if age := res.Ages[ok.name]; age == nil || age.Cached {
+		t.Errorf("got age %v of %s, want live", age, ok.name)
+	}
+
+	// the failure isn't cached, the backend is listed again
+	if _, err := Find(context.Background(), []string{failed.name}, []string{"api"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if failed.Calls() != 2 {
+		t.Errorf("listed the failed backend %d times, want 2", failed.Calls())
+	}
+}
+
+func TestFindSortsBackendErrors(t *testing.T) {
+	useTestCache(t)
+
+	backends := []*testBackend{newTestBackend(), newTestBackend(), newTestBackend()}
+	bucketNames := make([]string, len(backends))
+	for n, b := range backends {
+		b.list = func(ctx context.Context) (place.Printable, error) {
+			return nil, errors.New("denied")
+		}
+
+		bucketNames[len(backends)-n-1] = b.name
+	}
+
+	res, err := Find(context.Background(), bucketNames, []string{"api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Instances) != 0 || len(res.Errors) != len(backends) {
+		t.Fatalf("found %d instances and %d errors, want %d errors only", len(res.Instances), len(res.Errors), len(backends))
+	}
+
+	sorted := append([]string{}, bucketNames...)
+	sort.Strings(sorted)
+
+	for n, e := range res.Errors {
+		if want := sorted[n]; e.Backend != want || e.Error() != want+": denied" {
+			t.Errorf("got error %d %q, want the one of %s", n, e.Error(), want)
+		}
+	}
+}
+
+func TestFindTimeoutKeepsPages(t *testing.T) {
+	useTestCache(t)
+
+	// the backend honours the context, but never finishes
+	s := newTestStreamer("api-1", "api-2")
+	s.wait = func(ctx context.Context) error {
+		<-ctx.Done()
+
+		return ctx.Err()
+	}
+
+	ctx, ci := place.AddConfig(context.Background())
+	ci.Timeout = 50 * time.Millisecond
+
+	out := make(chan place.Printable, 2)
+	res, err := FindStream(ctx, []string{s.name}, []string{"api"}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.waitListed(t)
+
+	if got := names(res.Instances); got != "api-1 api-2" {
+		t.Errorf("found %s, want the pages sent before the timeout", got)
+	}
+
+	if len(out) != 2 {
+		t.Errorf("streamed %d pages, want 2", len(out))
+	}
+
+	if len(res.Errors) != 1 || !res.Errors[0].TimedOut || res.Errors[0].Error() != s.name+": timed out after 50ms" {
+		t.Fatalf("got errors %v, want a timeout after 50ms", res.Errors)
+	}
+
+	if stats, err := CacheDB.Stats(); err != nil || len(stats) != 0 {
+		t.Errorf("got cache stats %v, %v, want the partial result not cached", stats, err)
+	}
+}
+
+func TestFindBackendTimeout(t *testing.T) {
+	useTestCache(t)
+
+	slow := func(d time.Duration) func(ctx context.Context) (place.Printable, error) {
+		return func(ctx context.Context) (place.Printable, error) {
+			select {
+			case <-time.After(d):
+				return nil, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	// the backend timeouts win over the global one, shorter or longer
+	short, long, global := newTestBackend("api"), newTestBackend("api"), newTestBackend("api")
+	short.list, long.list, global.list = slow(time.Second), slow(150*time.Millisecond), slow(time.Second)
+	t.Setenv(place.ConfigToEnv(short.name, "timeout"), "50ms")
+	t.Setenv(place.ConfigToEnv(long.name, "timeout"), "2s")
+
+	ctx, ci := place.AddConfig(context.Background())
+	ci.Timeout = 100 * time.Millisecond
+
+	start := time.Now()
+	res, err := Find(ctx, []string{short.name, long.name, global.name}, []string{"api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	short.waitListed(t)
+	global.waitListed(t)
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("the search took %s, want the slow backends given up", elapsed)
+	}
+
+	timedOut := make(map[string]string)
+	for _, e := range res.Errors {
+		if e.TimedOut {
+			timedOut[e.Backend] = e.Err.Error()
+		}
+	}
+
+	if len(res.Errors) != 2 || timedOut[short.name] != "timed out after 50ms" || timedOut[global.name] != "timed out after 100ms" {
+		t.Errorf("got errors %v, want %s and %s timed out", res.Errors, short.name, global.name)
+	}
+
+	if _, ok := res.Ages[long.name]; !ok {
+		t.Errorf("%s timed out, want its own timeout used", long.name)
+	}
+}
+
+func TestFindServesStale(t *testing.T) {
+	useTestCache(t)
+
+	var stale []*Refresh
+	OnStale = func(ctx context.Context, r *Refresh) {
+		stale = append(stale, r)
+	}
+
+	b := newTestBackend("api")
+	ctx, ci := place.AddConfig(context.Background())
+	ci.CacheTTL = 100 * time.Millisecond
+	ci.StaleTTL = time.Minute
+
+	res, err := Find(ctx, []string{b.name}, []string{"api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetchedAt := res.Ages[b.name].FetchedAt
+
+	// about to expire, the entry is served and refreshed
+	time.Sleep(90 * time.Millisecond)
+
+	for n := 0; n < 2; n++ {
+		res, err = Find(ctx, []string{b.name}, []string{"api"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if age := res.Ages[b.name]; !age.Cached || !age.Stale || names(res.Instances) != "api" {
+			t.Fatalf("found %s, age %v, want the stale entry served", names(res.Instances), age)
+		}
+	}
+
+	if len(stale) != 1 || stale[0].Backend != b.name {
+		t.Fatalf("got stale entries %v, want a single refresh of %s", stale, b.name)
+	}
+
+	if b.Calls() != 1 {
+		t.Errorf("listed the backend %d times, want the refresh left to OnStale", b.Calls())
+	}
+
+	// expired, the entry is still served within the stale ttl
+	time.Sleep(20 * time.Millisecond)
+
+	res, err = Find(ctx, []string{b.name}, []string{"api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if age := res.Ages[b.name]; !age.Cached || !age.Stale || age.Age() < ci.CacheTTL {
+		t.Fatalf("got age %v, want the expired entry served", age)
+	}
+
+	if err := RefreshCache(ctx, stale[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.Calls() != 2 {
+		t.Errorf("listed the backend %d times, want the refresh to list it", b.Calls())
+	}
+
+	res, err = Find(ctx, []string{b.name}, []string{"api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if age := res.Ages[b.name]; !age.Cached || age.Stale || !age.FetchedAt.After(fetchedAt) {
+		t.Errorf("got age %v, want the refreshed entry", age)
+	}
+}
+
+func TestFindRefreshesStaleInBackground(t *testing.T) {
+	useTestCache(t)
+
+	b := newTestBackend("api")
+	ctx, ci := place.AddConfig(context.Background())
+	ci.CacheTTL = 50 * time.Millisecond
+	ci.StaleTTL = time.Minute
+
+	if _, err := Find(ctx, []string{b.name}, []string{"api"}); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	res, err := Find(ctx, []string{b.name}, []string{"api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !res.Ages[b.name].Stale {
+		t.Fatalf("got age %v, want the stale entry served", res.Ages[b.name])
+	}
+
+	for n := 0; n < 100 && b.Calls() < 2; n++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if b.Calls() != 2 {
+		t.Fatalf("listed the backend %d times, want it refreshed", b.Calls())
+	}
+
+	// the refresh may still be storing its entry
+	for n := 0; n < 100; n++ {
+		if res, err = Find(ctx, []string{b.name}, []string{"api"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if !res.Ages[b.name].Stale {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Errorf("got age %v, want the refreshed entry", res.Ages[b.name])
+}
+
+func TestFindEmptyNotServedStale(t *testing.T) {
+	useTestCache(t)
+
+	b := newTestBackend("web")
+	ctx, ci := place.AddConfig(context.Background())
+	ci.CacheTTL = 50 * time.Millisecond
+	ci.StaleTTL = time.Minute
+	ci.NegativeCacheTTL = 50 * time.Millisecond
+
+	for n := 0; n < 2; n++ {
+		if _, err := Find(ctx, []string{b.name}, []string{"api"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if b.Calls() != 1 {
+		t.Fatalf("listed the backend %d times, want the empty result cached", b.Calls())
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	res, err := Find(ctx, []string{b.name}, []string{"api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Ages[b.name].Cached || b.Calls() != 2 {
+		t.Errorf("got age %v after %d lists, want the expired empty result listed again", res.Ages[b.name], b.Calls())
+	}
+}
+
+func TestFindCacheKeyConfig(t *testing.T) {
+	useTestCache(t)
+
+	b := newTestBackend("api")
+	ctx := context.Background()
+
+	find := func() *DataAge {
+		t.Helper()
+
+		res, err := Find(ctx, []string{b.name}, []string{"api"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return res.Ages[b.name]
+	}
+
+	find()
+
+	// the common options don't change the instances found
+	t.Setenv(place.ConfigToEnv(b.name, "timeout"), "1m")
+	t.Setenv(place.ConfigToEnv(b.name, "cache_ttl"), "1h")
+
+	if age := find(); !age.Cached || b.Calls() != 1 {
+		t.Errorf("got age %v after %d lists, want the cache kept with the common options", age, b.Calls())
+	}
+
+	t.Setenv(place.ConfigToEnv(b.name, "region"), "eu-west-1")
+
+	if age := find(); age.Cached || b.Calls() != 2 {
+		t.Errorf("got age %v after %d lists, want the backend listed with the new config", age, b.Calls())
+	}
+
+	if age := find(); !age.Cached || b.Calls() != 2 {
+		t.Errorf("got age %v after %d lists, want the cache of the new config", age, b.Calls())
+	}
+
+	// the index synced with another config isn't used either
+	if _, err := Sync(ctx, []string{b.name}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(place.ConfigToEnv(b.name, "region"), "us-east-1")
+
+	if results, err := Sync(ctx, []string{b.name}, false); err != nil || results[0].Skipped {
+		t.Errorf("got sync results %+v, %v, want the backend synced with the new config", results[0], err)
+	}
+
+	if b.Calls() != 4 {
+		t.Errorf("listed the backend %d times, want 4", b.Calls())
+	}
+}
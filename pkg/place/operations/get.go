@@ -0,0 +1,67 @@
+package operations
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/bringg/honey/pkg/place"
+)
+
+// Get fetches a single instance of the backend by its id, the backend
+// must implement place.Getter. The cache isn't used, the instance is
+// always fresh, unless it is taken from the index with --offline or
+// from the snapshot of --from-snapshot.
+func Get(ctx context.Context, bucketName string, id string) (*place.Instance, error) {
+	if id == "" {
+		return nil, errors.New("instance id is missing")
+	}
+
+	if path := place.GetConfig(ctx).FromSnapshot; path != "" {
+		return getSnapshot(path, bucketName, id)
+	}
+
+	info, err := findInfo(bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	if place.GetConfig(ctx).Offline {
+		return getIndex(bucketName, id)
+	}
+
+	m := place.ConfigMap(info, bucketName)
+
+	opt, err := place.GetCommonOptions(m)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := place.GetConfig(ctx).Timeout
+	if opt.Timeout > 0 {
+		timeout = time.Duration(opt.Timeout)
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	ctx = place.AddLimiter(ctx, bucketName, opt)
+
+	backend, err := info.NewBackend(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+
+	getter, ok := backend.(place.Getter)
+	if !ok {
+		return nil, errors.Errorf("backend %s can't get an instance by id", bucketName)
+	}
+
+	log.Debugf("getting instance %s from backend %s", id, bucketName)
+
+	return getter.Get(ctx, bucketName, id)
+}
@@ -0,0 +1,361 @@
+package operations
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rclone/rclone/fs/config/configmap"
+
+	"github.com/bringg/honey/pkg/place"
+	"github.com/bringg/honey/pkg/place/query"
+)
+
+type (
+	// pattern is a parsed filter of the search
+	pattern struct {
+		text         string
+		query        *query.Query
+		backendTerms query.Terms
+		matcher      *query.Matcher
+	}
+
+	// search is the search of a single backend for all the patterns
+	// which select it, the backend is listed once
+	search struct {
+		// query is sent to the backend, it is the query of the single
+		// pattern, or the free text of all the patterns and the terms
+		// they share
+		query *query.Query
+		// patterns tag the results if several patterns are searched
+		patterns []*pattern
+	}
+)
+
+// parsePatterns parses the filters, a filter must not be empty
+func parsePatterns(ctx context.Context, filters []string) ([]*pattern, error) {
+	if len(filters) == 0 {
+		return nil, errors.New("filter text is missing")
+	}
+
+	patterns := make([]*pattern, 0, len(filters))
+	for _, text := range filters {
+		q, err := query.Parse(text)
+		if err != nil {
+			return nil, err
+		}
+
+		if q.IsEmpty() {
+			return nil, errors.New("filter text is missing")
+		}
+
+		// fail fast on a bad match mode or regexp instead of once per backend
+		m, err := place.PatternMatcher(ctx, q.Pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		backendTerms := q.Terms.Field(query.FieldBackend)
+		q.Terms = q.Terms.Without(query.FieldBackend)
+
+		patterns = append(patterns, &pattern{
+			text:         text,
+			query:        q,
+			backendTerms: backendTerms,
+			matcher:      m,
+		})
+	}
+
+	return patterns, nil
+}
+
+// newSearch returns the search of the backend, nil if all the patterns
+// exclude it. With several patterns the backend is listed once for the
+// free text of all of them and the terms they share, the patterns are
+// ORed on the results.
+func newSearch(patterns []*pattern, bucketName, backendType string) *search {
+	s := new(search)
+	for _, p := range patterns {
+		if p.backendTerms.Match(func(string) []string { return []string{bucketName, backendType} }) {
+			s.patterns = append(s.patterns, p)
+		}
+	}
+
+	switch {
+	case len(s.patterns) == 0:
+		return nil
+	case len(patterns) == 1:
+		s.query = s.patterns[0].query
+		s.patterns = nil
+	default:
+		s.query = &query.Query{
+			Patterns: freeTexts(s.patterns),
+			Terms:    commonTerms(s.patterns),
+		}
+	}
+
+	return s
+}
+
+// freeTexts returns the distinct free text patterns of the patterns
+func freeTexts(patterns []*pattern) []string {
+	texts := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		if !contains(texts, p.query.Pattern) {
+			texts = append(texts, p.query.Pattern)
+		}
+	}
+
+	return texts
+}
+
+// commonTerms returns the terms of the first pattern which all the
+// other patterns have too
+func commonTerms(patterns []*pattern) query.Terms {
+	terms := make(query.Terms, 0)
+	for _, t := range patterns[0].query.Terms {
+		shared := true
+		for _, p := range patterns[1:] {
+			if !hasTerm(p.query.Terms, t) {
+				shared = false
+
+				break
+			}
+		}
+
+		if shared {
+			terms = append(terms, t)
+		}
+	}
+
+	return terms
+}
+
+func hasTerm(terms query.Terms, t *query.Term) bool {
+	for _, other := range terms {
+		if other.String() == t.String() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tag returns the instances of the page which match any of the
+// patterns, tagged with the patterns they match
+func (s *search) tag(page place.Printable) place.Printable {
+	if s.patterns == nil {
+		return page
+	}
+
+	tagged := make(place.Printable, 0, len(page))
+	for _, i := range page {
+		matched := make([]string, 0)
+		for _, p := range s.patterns {
+			if p.matches(i) && p.query.Terms.Match(i.Values) {
+				matched = append(matched, p.text)
+			}
+		}
+
+		if len(matched) == 0 {
+			continue
+		}
+
+		ins := *i
+		ins.Patterns = matched
+		tagged = append(tagged, &ins)
+	}
+
+	return tagged
+}
+
+// listPatterns lists the backend once for all the free text patterns of
+// q, the backend tags the instances with the ones they match. The
+// backends which only implement List are listed per pattern and the
+// instances tagged here. The results are cached per pattern, as the
+// search of the pattern alone, so they are shared with the searches of
+// a single pattern. They are served from the cache only if all the
+// patterns have a usable entry, an instance is sent once.
+func listPatterns(ctx context.Context, policy *cachePolicy, info *place.RegInfo, m configmap.Mapper, bucketName string, backend place.Backend, q *query.Query, matcher *query.Matcher, match func(place.Printable) place.Printable, pages chan<- place.Printable) (*DataAge, error) {
+	fingerprint := place.ConfigFingerprint(info, m)
+
+	streamer, isStreamer := backend.(place.Streamer)
+	querier, isQuerier := backend.(place.Querier)
+
+	searches := make([]string, len(q.Patterns))
+	keys := make([][]byte, len(q.Patterns))
+	for n, pattern := range q.Patterns {
+		pm, err := place.PatternMatcher(ctx, pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		// backends which can't push down the terms only list by the pattern
+		pq := &query.Query{Pattern: pattern, Terms: q.Terms}
+		key := pattern
+		if isQuerier || isStreamer {
+			key = pq.String()
+		}
+
+		searches[n] = pm.String() + ":" + pq.String()
+		keys[n] = []byte(backend.CacheKeyName(fingerprint + ":" + pm.String() + ":" + key))
+	}
+
+	// try to take from cache
+	if !policy.NoCache && !policy.Disabled {
+		if age, entries := cachedPatterns(bucketName, policy, keys); entries != nil {
+			log.Debugf("using cache: %s, provider %s, patterns %q, %s", bucketName, info.Name, q.Patterns, age)
+
+			for n, entry := range entries {
+				if entry.stale(policy) {
+					refreshStale(ctx, &Refresh{Backend: bucketName, Search: searches[n]})
+				}
+			}
+
+			return age, place.SendPage(ctx, pages, match(tagEntries(q.Patterns, entries)))
+		}
+
+		if index, err := readIndex(bucketName); err == nil && index.Fingerprint == fingerprint && time.Since(index.SyncedAt) < policy.TTL {
+			return listIndex(ctx, bucketName, index, matcher, match, pages)
+		}
+	}
+
+	age := &DataAge{FetchedAt: time.Now()}
+
+	var (
+		ins place.Printable
+		err error
+	)
+
+	switch {
+	case isStreamer:
+		ins, err = streamBackend(ctx, streamer, bucketName, q, match, pages)
+	case isQuerier:
+		ins, err = querier.ListQuery(ctx, bucketName, q)
+	default:
+		ins, err = listEach(ctx, backend, bucketName, q.Patterns)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("using backend: %s, provider %s, patterns %q, found: %d items", bucketName, backend.Name(), q.Patterns, len(ins))
+
+	// store to cache, as the searches of every pattern alone
+	if !policy.Disabled {
+		for n, pattern := range q.Patterns {
+			putCache(ctx, policy, bucketName, keys[n], &cachedList{FetchedAt: age.FetchedAt, Instances: untag(ins, pattern)})
+		}
+	}
+
+	if isStreamer {
+		return age, nil
+	}
+
+	return age, place.SendPage(ctx, pages, match(ins))
+}
+
+// listEach lists the backend for every pattern, the instances are
+// tagged with the patterns they were listed for
+func listEach(ctx context.Context, backend place.Backend, bucketName string, patterns []string) (place.Printable, error) {
+	lists := make([]*cachedList, len(patterns))
+	for n, pattern := range patterns {
+		ins, err := backend.List(ctx, bucketName, pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		lists[n] = &cachedList{Instances: ins}
+	}
+
+	return tagEntries(patterns, lists), nil
+}
+
+// cachedPatterns returns the usable cache entries of the keys and the
+// age of the oldest one, nil if one of the keys has none
+func cachedPatterns(bucketName string, policy *cachePolicy, keys [][]byte) (*DataAge, []*cachedList) {
+	var (
+		oldest time.Time
+		stale  bool
+	)
+
+	entries := make([]*cachedList, len(keys))
+	for n, key := range keys {
+		entry := new(cachedList)
+		if err := CacheDB.Get(bucketName, key, entry); err != nil || !entry.usable(policy) {
+			log.Debugf("no usable cache: %s, key `%s`: %v", bucketName, key, err)
+
+			return nil, nil
+		}
+
+		entries[n] = entry
+		if n == 0 || entry.FetchedAt.Before(oldest) {
+			oldest = entry.FetchedAt
+		}
+
+		stale = stale || entry.stale(policy)
+	}
+
+	return &DataAge{FetchedAt: oldest, Cached: true, Stale: stale}, entries
+}
+
+// tagEntries returns the instances of the cache entries of the patterns,
+// tagged with the patterns of the entries they are in
+func tagEntries(patterns []string, entries []*cachedList) place.Printable {
+	byKey := make(map[string]*place.Instance)
+	tagged := make(place.Printable, 0)
+	for n, entry := range entries {
+		for _, i := range entry.Instances {
+			if t, ok := byKey[i.Key()]; ok {
+				t.Patterns = append(t.Patterns, patterns[n])
+
+				continue
+			}
+
+			t := *i
+			t.Patterns = []string{patterns[n]}
+			byKey[i.Key()] = &t
+			tagged = append(tagged, &t)
+		}
+	}
+
+	return tagged
+}
+
+// untag returns the instances tagged with the pattern without their
+// tags, as the search of the pattern alone returns them
+func untag(ins place.Printable, pattern string) place.Printable {
+	untagged := make(place.Printable, 0)
+	for _, i := range ins {
+		if contains(i.Patterns, pattern) {
+			u := *i
+			u.Patterns = nil
+			untagged = append(untagged, &u)
+		}
+	}
+
+	return untagged
+}
+
+// matches returns true if the instance matches the free text of the
+// pattern. The backends which search several patterns at once tag the
+// instances with the ones they match, like they match a single one,
+// the other instances, e.g. of a snapshot, are matched by MatchPattern.
+func (p *pattern) matches(i *place.Instance) bool {
+	if len(i.Patterns) == 0 {
+		return i.MatchPattern(p.matcher)
+	}
+
+	return contains(i.Patterns, p.query.Pattern)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
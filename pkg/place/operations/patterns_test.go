@@ -0,0 +1,96 @@
+package operations
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bringg/honey/pkg/place"
+)
+
+func TestSearchPatterns(t *testing.T) {
+	patterns, err := parsePatterns(context.Background(), []string{"api status=running", "api status=stopped", "10.0.0.0/24 status=running"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newSearch(patterns, "aws", "aws")
+	if got := strings.Join(s.query.Patterns, ","); got != "api,10.0.0.0/24" {
+		t.Errorf("patterns = %s, want api,10.0.0.0/24", got)
+	}
+
+	if len(s.query.Terms) != 0 {
+		t.Errorf("terms = %v, want none", s.query.Terms)
+	}
+
+	page := place.Printable{
+		// tagged by the backend, the ip is of an interface Model hasn't
+		{Model: place.Model{ID: "i-1", BackendName: "aws", Name: "web", Status: "running", Patterns: []string{"10.0.0.0/24"}}},
+		{Model: place.Model{ID: "i-2", BackendName: "aws", Name: "api", Status: "stopped", Patterns: []string{"api"}}},
+		// not tagged, e.g. of a snapshot
+		{Model: place.Model{ID: "i-3", BackendName: "aws", Name: "api-1", Status: "running", PrivateIP: "10.0.0.3"}},
+		{Model: place.Model{ID: "i-4", BackendName: "aws", Name: "db", Status: "running"}},
+	}
+
+	tagged := s.tag(page)
+
+	want := map[string]string{
+		"i-1": "10.0.0.0/24 status=running",
+		"i-2": "api status=stopped",
+		"i-3": "api status=running,10.0.0.0/24 status=running",
+	}
+
+	if len(tagged) != len(want) {
+		t.Fatalf("got %d instances, want %d", len(tagged), len(want))
+	}
+
+	for _, i := range tagged {
+		if got := strings.Join(i.Patterns, ","); got != want[i.ID] {
+			t.Errorf("%s patterns = %s, want %s", i.ID, got, want[i.ID])
+		}
+	}
+}
+
+func TestPatternsCacheEntries(t *testing.T) {
+	ins := place.Printable{
+		{Model: place.Model{ID: "i-1", BackendName: "aws", Patterns: []string{"api", "web"}}},
+		{Model: place.Model{ID: "i-2", BackendName: "aws", Patterns: []string{"web"}}},
+	}
+
+	entries := []*cachedList{{Instances: untag(ins, "api")}, {Instances: untag(ins, "web")}}
+	if len(entries[0].Instances) != 1 || len(entries[1].Instances) != 2 || entries[1].Instances[0].Patterns != nil {
+		t.Fatalf("got cache entries %v %v", entries[0].Instances, entries[1].Instances)
+	}
+
+	tagged := tagEntries([]string{"api", "web"}, entries)
+	if len(tagged) != 2 || strings.Join(tagged[0].Patterns, ",") != "api,web" || strings.Join(tagged[1].Patterns, ",") != "web" {
+		t.Errorf("got tagged instances %v", tagged)
+	}
+}
+
+func TestCachedPatternsStale(t *testing.T) {
+	useTestCache(t)
+
+	policy := &cachePolicy{TTL: 10 * time.Minute, StaleTTL: time.Hour, NegativeTTL: time.Hour}
+	now := time.Now()
+
+	// the entries which found nothing aren't stale, even if older
+	for key, entry := range map[string]*cachedList{
+		"api": {FetchedAt: now.Add(-9 * time.Minute), Instances: place.Printable{{Model: place.Model{ID: "i-1"}}}},
+		"db":  {FetchedAt: now.Add(-20 * time.Minute)},
+	} {
+		if err := CacheDB.Put("aws", []byte(key), entry, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	age, entries := cachedPatterns("aws", policy, [][]byte{[]byte("api"), []byte("db")})
+	if entries == nil {
+		t.Fatal("no usable cache entries")
+	}
+
+	if !age.Stale || !age.FetchedAt.Equal(now.Add(-20*time.Minute)) {
+		t.Errorf("got age %+v, want stale and of the oldest entry", age)
+	}
+}
@@ -0,0 +1,90 @@
+package operations
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/bringg/honey/pkg/place"
+	"github.com/bringg/honey/pkg/place/query"
+)
+
+// Refresh is a stale cache entry to refresh
+type Refresh struct {
+	// Backend is the config section of the backend
+	Backend string
+	// Search is the match mode and the query of the entry, e.g.
+	// `substring/i:api status=running`
+	Search string
+}
+
+var (
+	// OnStale is called with the stale cache entries served by Find, if
+	// nil they are refreshed in the background of the process. The CLI,
+	// which exits once done, sets it to refresh them in a detached
+	// process.
+	OnStale func(ctx context.Context, r *Refresh)
+
+	// refreshing are the entries being refreshed
+	refreshing sync.Map
+)
+
+// refreshStale passes the stale entry to OnStale unless it is already
+// being refreshed
+func refreshStale(ctx context.Context, r *Refresh) {
+	if _, loaded := refreshing.LoadOrStore(*r, struct{}{}); loaded {
+		return
+	}
+
+	if OnStale != nil {
+		OnStale(ctx, r)
+
+		return
+	}
+
+	// the search may be done before the refresh
+	rctx, rci := place.AddConfig(context.Background())
+	*rci = *place.GetConfig(ctx)
+
+	go func() {
+		defer refreshing.Delete(*r)
+
+		if err := RefreshCache(rctx, r); err != nil {
+			log.Debugf("can't refresh %s `%s`: %v", r.Backend, r.Search, err)
+		}
+	}()
+}
+
+// RefreshCache searches the backend again, bypassing the cache, and
+// stores the results
+func RefreshCache(ctx context.Context, r *Refresh) error {
+	info, err := findInfo(r.Backend)
+	if err != nil {
+		return err
+	}
+
+	spec := strings.SplitN(r.Search, ":", 2)
+	if len(spec) != 2 {
+		return errors.Errorf("invalid search %q, use mode[/i]:query", r.Search)
+	}
+
+	ctx, ci := place.AddConfig(ctx)
+	ci.NoCache = true
+	ci.MatchMode = strings.TrimSuffix(spec[0], "/i")
+	ci.IgnoreCase = strings.HasSuffix(spec[0], "/i")
+
+	q, err := query.Parse(spec[1])
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("refreshing %s `%s`", r.Backend, r.Search)
+
+	if _, err := findBackend(ctx, info, r.Backend, q, func(place.Printable) {}); err != nil {
+		return err
+	}
+
+	return nil
+}
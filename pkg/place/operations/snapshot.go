@@ -0,0 +1,334 @@
+package operations
+
+import (
+	"context"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+
+	"github.com/bringg/honey/pkg/place"
+	"github.com/bringg/honey/pkg/place/cache"
+	"github.com/bringg/honey/pkg/place/query"
+)
+
+// snapshotVersion is the version of the snapshot files written
+const snapshotVersion = 1
+
+type (
+	// Snapshot is the portable file of the results of a search, it is
+	// searched with --from-snapshot without the backends credentials
+	Snapshot struct {
+		Version   int                `json:"version"`
+		CreatedAt time.Time          `json:"created_at"`
+		Filters   []string           `json:"filters,omitempty"`
+		Backends  []*SnapshotBackend `json:"backends"`
+		// Instances are the instances as found, their labels and raw
+		// data keep the keys of the provider, they are only converted
+		// when printed
+		Instances jsoniter.RawMessage `json:"instances"`
+	}
+
+	// SnapshotBackend is a backend searched by the snapshot
+	SnapshotBackend struct {
+		// Name is the config section of the backend
+		Name      string    `json:"name"`
+		Type      string    `json:"type"`
+		FetchedAt time.Time `json:"fetched_at"`
+	}
+
+	// snapshotInstance is an instance of the snapshot file
+	snapshotInstance struct {
+		place.Model
+		Raw interface{} `json:"raw"`
+	}
+
+	// loadedSnapshot is a snapshot read for --from-snapshot
+	loadedSnapshot struct {
+		filters   []string
+		backends  map[string]*SnapshotBackend
+		instances map[string]place.Printable
+	}
+)
+
+var (
+	snapshotsMu sync.Mutex
+	// snapshots are the snapshots read, by path
+	snapshots = make(map[string]*loadedSnapshot)
+)
+
+// NewSnapshot returns the snapshot of the instances found by the
+// search of the filters, the backends which failed aren't part of it.
+// Merged instances can't be saved, they are merged when the snapshot is
+// searched with --merge.
+func NewSnapshot(ctx context.Context, res *Result, filters []string) (*Snapshot, error) {
+	instances := make([]*snapshotInstance, len(res.Instances))
+	for n, i := range res.Instances {
+		if len(i.Sources) > 0 {
+			return nil, errors.New("merged instances can't be saved to a snapshot, use --merge when searching it")
+		}
+
+		instances[n] = &snapshotInstance{Model: i.Model, Raw: i.Raw}
+		// the patterns of the search are in the filters
+		instances[n].Patterns = nil
+	}
+
+	data, err := jsoniter.Marshal(instances)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Snapshot{
+		Version:   snapshotVersion,
+		CreatedAt: time.Now(),
+		Filters:   filters,
+		Backends:  make([]*SnapshotBackend, 0, len(res.Ages)),
+		Instances: data,
+	}
+
+	for name, age := range res.Ages {
+		info, err := searchInfo(place.GetConfig(ctx), name)
+		if err != nil {
+			return nil, err
+		}
+
+		s.Backends = append(s.Backends, &SnapshotBackend{
+			Name:      name,
+			Type:      info.Name,
+			FetchedAt: age.FetchedAt,
+		})
+	}
+
+	sort.Slice(s.Backends, func(a, b int) bool {
+		return s.Backends[a].Name < s.Backends[b].Name
+	})
+
+	return s, nil
+}
+
+// Indexed returns all the instances of the backends in the index of
+// honey sync, or in the snapshot of --from-snapshot, for a snapshot of
+// everything. The backends which weren't synced are errors of the
+// Result.
+func Indexed(ctx context.Context, backendNames []string) (*Result, error) {
+	ci := place.GetConfig(ctx)
+	res := &Result{Ages: make(map[string]*DataAge, len(backendNames))}
+
+	for _, bucketName := range backendNames {
+		if _, err := searchInfo(ci, bucketName); err != nil {
+			return nil, err
+		}
+
+		var (
+			instances place.Printable
+			age       *DataAge
+			err       error
+		)
+
+		if ci.FromSnapshot != "" {
+			instances, age, err = snapshotInstances(ci.FromSnapshot, bucketName)
+		} else {
+			var entry *indexEntry
+			if entry, err = readIndex(bucketName); err == nil {
+				instances, age = entry.Instances, &DataAge{FetchedAt: entry.SyncedAt, Cached: true}
+			} else if errors.Is(err, cache.ErrNotFound) {
+				err = errors.Errorf("backend %s isn't synced, run honey sync", bucketName)
+			}
+		}
+
+		if err != nil {
+			res.Errors = append(res.Errors, &BackendError{Backend: bucketName, Err: err})
+
+			continue
+		}
+
+		res.Instances = append(res.Instances, instances...)
+		res.Ages[bucketName] = age
+	}
+
+	sort.Sort(res.Errors)
+
+	return res, nil
+}
+
+// WriteSnapshot writes the snapshot to the file of path
+func WriteSnapshot(path string, s *Snapshot) error {
+	data, err := jsoniter.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0600)
+}
+
+// ReadSnapshot reads the snapshot file of path
+func ReadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(Snapshot)
+	if err := jsoniter.Unmarshal(data, s); err != nil {
+		return nil, errors.Wrapf(err, "invalid snapshot %s", path)
+	}
+
+	if s.Version != snapshotVersion {
+		return nil, errors.Errorf("snapshot %s has the unsupported version %d", path, s.Version)
+	}
+
+	return s, nil
+}
+
+// Decode returns the instances of the snapshot
+func (s *Snapshot) Decode() (place.Printable, error) {
+	decoded := make([]*snapshotInstance, 0)
+	if err := jsoniter.Unmarshal(s.Instances, &decoded); err != nil {
+		return nil, errors.Wrap(err, "invalid snapshot instances")
+	}
+
+	instances := make(place.Printable, len(decoded))
+	for n, i := range decoded {
+		instances[n] = &place.Instance{Model: i.Model, Raw: i.Raw}
+	}
+
+	return instances, nil
+}
+
+// SnapshotBackends returns the backends of the snapshot file of path
+func SnapshotBackends(path string) ([]string, error) {
+	l, err := loadSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(l.backends))
+	for name := range l.backends {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// SnapshotFilters returns the filters of the search the snapshot file
+// of path was saved with, none if it has all the instances
+func SnapshotFilters(path string) ([]string, error) {
+	l, err := loadSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return l.filters, nil
+}
+
+// loadSnapshot reads the snapshot of path once
+func loadSnapshot(path string) (*loadedSnapshot, error) {
+	snapshotsMu.Lock()
+	defer snapshotsMu.Unlock()
+
+	if l, ok := snapshots[path]; ok {
+		return l, nil
+	}
+
+	s, err := ReadSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+
+	instances, err := s.Decode()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &loadedSnapshot{
+		filters:   s.Filters,
+		backends:  make(map[string]*SnapshotBackend, len(s.Backends)),
+		instances: make(map[string]place.Printable, len(s.Backends)),
+	}
+
+	for _, b := range s.Backends {
+		l.backends[b.Name] = b
+	}
+
+	for _, i := range instances {
+		if _, ok := l.backends[i.BackendName]; !ok {
+			return nil, errors.Errorf("invalid snapshot %s, instance %s has the unknown backend %q", path, i.ID, i.BackendName)
+		}
+
+		l.instances[i.BackendName] = append(l.instances[i.BackendName], i)
+	}
+
+	snapshots[path] = l
+
+	return l, nil
+}
+
+// snapshotInfo returns the registry info of the backend type in the
+// snapshot, the backend needn't be configured
+func snapshotInfo(path string, bucketName string) (*place.RegInfo, error) {
+	l, err := loadSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+
+	b, ok := l.backends[bucketName]
+	if !ok {
+		return nil, errors.Errorf("backend %s isn't in the snapshot %s", bucketName, path)
+	}
+
+	return place.Find(b.Type)
+}
+
+// listSnapshot sends the instances of the backend in the snapshot
+// matching the pattern of matcher on pages, match evaluates the rest of
+// the query
+func listSnapshot(ctx context.Context, path string, bucketName string, matcher *query.Matcher, match func(place.Printable) place.Printable, pages chan<- place.Printable) (*DataAge, error) {
+	instances, age, err := snapshotInstances(path, bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := matchPattern(instances, matcher)
+
+	log.Debugf("using snapshot: %s, pattern `%s`, found: %d items", bucketName, matcher.Pattern, len(matched))
+
+	return age, place.SendPage(ctx, pages, match(matched))
+}
+
+// snapshotInstances returns the instances of the backend in the
+// snapshot and their age
+func snapshotInstances(path string, bucketName string) (place.Printable, *DataAge, error) {
+	l, err := loadSnapshot(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b, ok := l.backends[bucketName]
+	if !ok {
+		return nil, nil, errors.Errorf("backend %s isn't in the snapshot %s", bucketName, path)
+	}
+
+	return l.instances[bucketName], &DataAge{FetchedAt: b.FetchedAt, Cached: true}, nil
+}
+
+// getSnapshot returns the instance of the backend in the snapshot with
+// the id
+func getSnapshot(path string, bucketName string, id string) (*place.Instance, error) {
+	instances, _, err := snapshotInstances(path, bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, i := range instances {
+		if i.ID == id {
+			return i, nil
+		}
+	}
+
+	return nil, place.ErrInstanceNotFound
+}
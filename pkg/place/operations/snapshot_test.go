@@ -0,0 +1,111 @@
+package operations
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/bringg/honey/pkg/place"
+)
+
+// ec2Instance is raw data like the one of the provider SDKs, without
+// json tags
+type ec2Instance struct {
+	InstanceType string
+	Placement    struct {
+		AvailabilityZone string
+	}
+}
+
+func testInstances() place.Printable {
+	raw := &ec2Instance{InstanceType: "t3.micro"}
+	raw.Placement.AvailabilityZone = "us-east-1a"
+
+	return place.Printable{
+		{
+			Model: place.Model{
+				ID:          "i-1",
+				BackendName: "aws",
+				Name:        "api",
+				Status:      "running",
+				PrivateIP:   "10.0.0.1",
+				Labels:      map[string]string{"Name": "api", "CostCenter": "x"},
+			},
+			Raw: raw,
+		},
+		{
+			Model: place.Model{
+				ID:          "i-2",
+				BackendName: "aws",
+				Name:        "db",
+				Status:      "stopped",
+			},
+		},
+	}
+}
+
+// roundTrip saves the instances to a snapshot file and loads them back
+func roundTrip(t *testing.T, instances place.Printable) place.Printable {
+	t.Helper()
+
+	s, err := NewSnapshot(context.Background(), &Result{Instances: instances}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "test.honey")
+	if err := WriteSnapshot(path, s); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := read.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return loaded
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	loaded := roundTrip(t, testInstances())
+	if len(loaded) != 2 {
+		t.Fatalf("got %d instances, want 2", len(loaded))
+	}
+
+	i := loaded[0]
+	if i.ID != "i-1" || i.Name != "api" || i.Status != "running" || i.PrivateIP != "10.0.0.1" {
+		t.Errorf("model changed: %+v", i.Model)
+	}
+
+	if i.Labels["CostCenter"] != "x" || i.Labels["Name"] != "api" {
+		t.Errorf("labels changed: %v", i.Labels)
+	}
+
+	for field, want := range map[string]string{
+		"labels.CostCenter":               "x",
+		"raw.instance_type":               "t3.micro",
+		"raw.placement.availability_zone": "us-east-1a",
+	} {
+		if got := i.Values(field); len(got) != 1 || got[0] != want {
+			t.Errorf("%s = %v, want %s", field, got, want)
+		}
+	}
+
+	raw, ok := i.Raw.(map[string]interface{})
+	if !ok || raw["InstanceType"] != "t3.micro" {
+		t.Errorf("raw keys changed: %v", i.Raw)
+	}
+}
+
+func TestSnapshotRefusesMergedInstances(t *testing.T) {
+	merged := append(testInstances(), &place.Instance{Model: place.Model{ID: "id-1", BackendName: "aws,consul", Sources: []string{"aws/i-1", "consul/id-1"}}})
+
+	if _, err := NewSnapshot(context.Background(), &Result{Instances: merged}, nil); err == nil {
+		t.Fatal("merged instances were saved")
+	}
+}
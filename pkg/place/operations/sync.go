@@ -0,0 +1,203 @@
+package operations
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/bringg/honey/pkg/place"
+	"github.com/bringg/honey/pkg/place/cache"
+	"github.com/bringg/honey/pkg/place/query"
+)
+
+// indexKey is the key of the instances of a backend in IndexDB
+var indexKey = []byte("instances")
+
+// IndexDB is the local index of all the instances of the backends
+// synced, the commands set a file store once the flags are parsed
+var IndexDB cache.Store = cache.NewMemoryStore()
+
+type (
+	// SyncResult is the sync of a single backend
+	SyncResult struct {
+		Backend   string
+		Instances int
+		SyncedAt  time.Time
+		// Skipped is true if the index of the backend was recent enough
+		Skipped bool
+		Err     *BackendError
+	}
+
+	// indexEntry is the index of the instances of a backend
+	indexEntry struct {
+		SyncedAt time.Time
+		// Fingerprint is the one of the config the backend was synced
+		// with, see place.ConfigFingerprint
+		Fingerprint string
+		Instances   place.Printable
+	}
+)
+
+// Sync lists every instance of the backends into the index, the
+// backends synced within their sync interval with the same config are
+// skipped unless force is set. The backends are synced in parallel and
+// one which fails keeps its previous index.
+func Sync(ctx context.Context, backendNames []string, force bool) ([]*SyncResult, error) {
+	ctx, ci := place.AddConfig(ctx)
+	ci.NoCache = true
+	ci.Offline = false
+	ci.MatchMode = string(query.MatchSubstring)
+
+	infos := make(map[string]*place.RegInfo, len(backendNames))
+	for _, bucketName := range backendNames {
+		info, err := findInfo(bucketName)
+		if err != nil {
+			return nil, err
+		}
+
+		infos[bucketName] = info
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results = make([]*SyncResult, 0, len(infos))
+	)
+
+	for bucketName, info := range infos {
+		wg.Add(1)
+
+		go func(bucketName string, info *place.RegInfo) {
+			defer wg.Done()
+
+			r := syncBackend(ctx, ci, info, bucketName, force)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			results = append(results, r)
+		}(bucketName, info)
+	}
+
+	wg.Wait()
+
+	sort.Slice(results, func(a, b int) bool {
+		return results[a].Backend < results[b].Backend
+	})
+
+	return results, nil
+}
+
+// syncBackend lists all the instances of a backend into the index, if
+// its index is older than its sync interval
+func syncBackend(ctx context.Context, ci *place.ConfigInfo, info *place.RegInfo, bucketName string, force bool) *SyncResult {
+	r := &SyncResult{Backend: bucketName}
+
+	m := place.ConfigMap(info, bucketName)
+	opt, err := place.GetCommonOptions(m)
+	if err != nil {
+		r.Err = &BackendError{Backend: bucketName, Err: err}
+
+		return r
+	}
+
+	interval := ci.SyncInterval
+	if opt.SyncInterval > 0 {
+		interval = time.Duration(opt.SyncInterval)
+	}
+
+	fingerprint := place.ConfigFingerprint(info, m)
+	if prev, err := readIndex(bucketName); err == nil && !force && prev.Fingerprint == fingerprint && time.Since(prev.SyncedAt) < interval {
+		r.Instances, r.SyncedAt, r.Skipped = len(prev.Instances), prev.SyncedAt, true
+
+		return r
+	}
+
+	entry := &indexEntry{SyncedAt: time.Now(), Fingerprint: fingerprint}
+	if _, berr := findBackend(ctx, info, bucketName, new(query.Query), func(page place.Printable) {
+		entry.Instances = append(entry.Instances, page...)
+	}); berr != nil {
+		r.Err = berr
+
+		return r
+	}
+
+	if err := IndexDB.Put(bucketName, indexKey, entry, 0); err != nil {
+		r.Err = &BackendError{Backend: bucketName, Err: errors.Wrap(err, "can't store the index")}
+
+		return r
+	}
+
+	log.Debugf("synced backend %s, %d instances", bucketName, len(entry.Instances))
+
+	r.Instances, r.SyncedAt = len(entry.Instances), entry.SyncedAt
+
+	return r
+}
+
+// readIndex returns the index of the backend
+func readIndex(bucketName string) (*indexEntry, error) {
+	entry := new(indexEntry)
+	if err := IndexDB.Get(bucketName, indexKey, entry); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// listIndex sends the indexed instances of the backend matching the
+// pattern of matcher on pages, match evaluates the rest of the query.
+// It fails with --offline if the backend was never synced.
+func listIndex(ctx context.Context, bucketName string, entry *indexEntry, matcher *query.Matcher, match func(place.Printable) place.Printable, pages chan<- place.Printable) (*DataAge, error) {
+	if entry == nil {
+		var err error
+		if entry, err = readIndex(bucketName); err != nil {
+			if errors.Is(err, cache.ErrNotFound) {
+				return nil, errors.Errorf("backend %s isn't synced, run honey sync", bucketName)
+			}
+
+			return nil, err
+		}
+	}
+
+	matched := matchPattern(entry.Instances, matcher)
+
+	log.Debugf("using index: %s, pattern `%s`, found: %d items", bucketName, matcher.Pattern, len(matched))
+
+	return &DataAge{FetchedAt: entry.SyncedAt, Cached: true}, place.SendPage(ctx, pages, match(matched))
+}
+
+// matchPattern returns the instances matching the pattern of matcher
+func matchPattern(instances place.Printable, matcher *query.Matcher) place.Printable {
+	matched := make(place.Printable, 0, len(instances))
+	for _, i := range instances {
+		if i.MatchPattern(matcher) {
+			matched = append(matched, i)
+		}
+	}
+
+	return matched
+}
+
+// getIndex returns the indexed instance of the backend with the id
+func getIndex(bucketName string, id string) (*place.Instance, error) {
+	entry, err := readIndex(bucketName)
+	if errors.Is(err, cache.ErrNotFound) {
+		return nil, errors.Errorf("backend %s isn't synced, run honey sync", bucketName)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, i := range entry.Instances {
+		if i.ID == id {
+			return i, nil
+		}
+	}
+
+	return nil, place.ErrInstanceNotFound
+}
@@ -0,0 +1,151 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bringg/honey/pkg/place"
+)
+
+func TestSyncOffline(t *testing.T) {
+	useTestCache(t)
+
+	b := newTestBackend("api", "api-db", "web")
+	ctx := context.Background()
+
+	results, err := Sync(ctx, []string{b.name}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 || results[0].Err != nil || results[0].Instances != 3 || results[0].Skipped {
+		t.Fatalf("got sync results %+v, want the 3 instances synced", results[0])
+	}
+
+	offline, ci := place.AddConfig(ctx)
+	ci.Offline = true
+
+	res, err := Find(offline, []string{b.name}, []string{"api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := names(res.Instances); got != "api api-db" {
+		t.Errorf("found %s offline, want api api-db", got)
+	}
+
+	if age := res.Ages[b.name]; !age.Cached || !age.FetchedAt.Equal(results[0].SyncedAt) {
+		t.Errorf("got age %v, want the one of the sync", age)
+	}
+
+	if got, err := Get(offline, b.name, "id-3"); err != nil || got.Name != "web" {
+		t.Errorf("got %v, %v, want web from the index", got, err)
+	}
+
+	if _, err := Get(offline, b.name, "id-4"); !errors.Is(err, place.ErrInstanceNotFound) {
+		t.Errorf("got %v, want the instance not found", err)
+	}
+
+	// a synced index is as good as a cache entry
+	res, err = Find(ctx, []string{b.name}, []string{"web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := names(res.Instances); got != "web" || !res.Ages[b.name].Cached {
+		t.Errorf("found %s, age %v, want web from the index", got, res.Ages[b.name])
+	}
+
+	if b.Calls() != 1 {
+		t.Errorf("listed the backend %d times, want it listed by the sync only", b.Calls())
+	}
+}
+
+func TestSyncInterval(t *testing.T) {
+	useTestCache(t)
+
+	b := newTestBackend("api")
+	ctx := context.Background()
+
+	if _, err := Sync(ctx, []string{b.name}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Sync(ctx, []string{b.name}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !results[0].Skipped || results[0].Instances != 1 || b.Calls() != 1 {
+		t.Errorf("got sync results %+v after %d lists, want the recent index kept", results[0], b.Calls())
+	}
+
+	if results, err = Sync(ctx, []string{b.name}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if results[0].Skipped || b.Calls() != 2 {
+		t.Errorf("got sync results %+v after %d lists, want the forced sync to list the backend", results[0], b.Calls())
+	}
+
+	// a backend which fails keeps its index
+	b.list = func(ctx context.Context) (place.Printable, error) {
+		return nil, errors.New("denied")
+	}
+
+	if results, err = Sync(ctx, []string{b.name}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if results[0].Err == nil {
+		t.Fatalf("got sync results %+v, want the error of the backend", results[0])
+	}
+
+	offline, ci := place.AddConfig(ctx)
+	ci.Offline = true
+
+	res, err := Find(offline, []string{b.name}, []string{"api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := names(res.Instances); got != "api" {
+		t.Errorf("found %s offline, want the index of the previous sync", got)
+	}
+}
+
+func TestOfflineNotSynced(t *testing.T) {
+	useTestCache(t)
+
+	synced, never := newTestBackend("api"), newTestBackend("api")
+
+	ctx, ci := place.AddConfig(context.Background())
+	if _, err := Sync(ctx, []string{synced.name}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	ci.Offline = true
+
+	res, err := Find(ctx, []string{synced.name, never.name}, []string{"api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Instances) != 1 || res.Instances[0].BackendName != synced.name {
+		t.Errorf("found %s, want the api of %s only", names(res.Instances), synced.name)
+	}
+
+	if len(res.Errors) != 1 || res.Errors[0].Backend != never.name || !strings.Contains(res.Errors[0].Error(), "isn't synced, run honey sync") {
+		t.Errorf("got errors %v, want %s not synced", res.Errors, never.name)
+	}
+
+	if never.Calls() != 0 {
+		t.Errorf("listed %s %d times offline", never.name, never.Calls())
+	}
+
+	if _, err := Get(ctx, never.name, "id-1"); err == nil || !strings.Contains(err.Error(), "isn't synced") {
+		t.Errorf("got %v, want %s not synced", err, never.name)
+	}
+}
@@ -0,0 +1,100 @@
+package operations
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/bringg/honey/pkg/place"
+)
+
+// WatchEvent is the result of a single search of Watch
+type WatchEvent struct {
+	Time    time.Time
+	Result  *Result
+	Changes []*place.Change
+	// First is true for the first search, all its instances are added
+	First bool
+}
+
+// Watch searches the backends every interval, bypassing the cache, and
+// calls fn with the instances and their changes since the previous
+// search. The instances of a backend which failed a search are kept
+// from the previous one, so they aren't reported as removed. Watch
+// returns once ctx is done or fn returns an error.
+func Watch(ctx context.Context, backendNames []string, filters []string, interval time.Duration, fn func(*WatchEvent) error) error {
+	ctx, ci := place.AddConfig(ctx)
+	ci.NoCache = true
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var prev place.Printable
+	for first := true; ; first = false {
+		res, err := Find(ctx, backendNames, filters)
+		if err != nil {
+			return err
+		}
+
+		// the search was interrupted, its results are partial
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if !first {
+			res.Instances = keepFailed(res.Instances, prev, res.Errors)
+		}
+
+		if err := fn(&WatchEvent{
+			Time:    time.Now(),
+			Result:  res,
+			Changes: res.Instances.Diff(prev),
+			First:   first,
+		}); err != nil {
+			return err
+		}
+
+		prev = res.Instances
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// keepFailed adds the previous instances of the failed backends which
+// weren't found again
+func keepFailed(instances, prev place.Printable, errs BackendErrors) place.Printable {
+	if len(errs) == 0 {
+		return instances
+	}
+
+	failed := make(map[string]struct{}, len(errs))
+	for _, e := range errs {
+		failed[e.Backend] = struct{}{}
+	}
+
+	found := make(map[string]struct{}, len(instances))
+	for _, i := range instances {
+		found[i.Key()] = struct{}{}
+	}
+
+	for _, i := range prev {
+		if _, ok := found[i.Key()]; ok {
+			continue
+		}
+
+		// merged instances are joined from several backends
+		for _, name := range strings.Split(i.BackendName, ",") {
+			if _, ok := failed[name]; ok {
+				instances = append(instances, i)
+
+				break
+			}
+		}
+	}
+
+	return instances
+}
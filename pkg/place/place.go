@@ -1,28 +1,87 @@
 package place
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"reflect"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/Rican7/conjson"
 	"github.com/Rican7/conjson/transform"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
+	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/rclone/rclone/fs/config/configstruct"
 	"github.com/sirupsen/logrus"
 	"github.com/tidwall/gjson"
+
+	"github.com/bringg/honey/pkg/place/query"
 )
 
+// fingerprintLen is the length of ConfigFingerprint
+const fingerprintLen = 12
+
 var (
 	// Registry Backend registry
 	Registry []*RegInfo
 
+	// ErrInstanceNotFound is returned by Getter.Get for an unknown id
+	ErrInstanceNotFound = errors.New("instance not found")
+
 	log = logrus.WithField("where", "place")
+
+	// commonOptions are the options every backend gets on Register
+	commonOptions = []Option{
+		{
+			Name:     "timeout",
+			Help:     "Maximum time to wait for the backend to answer, 0 to use the global --timeout",
+			Default:  fs.Duration(0),
+			Advanced: true,
+		},
+		{
+			Name:     "qps",
+			Help:     "Maximum API calls per second to the backend, 0 for no limit",
+			Default:  0.0,
+			Advanced: true,
+		},
+		{
+			Name:     "burst",
+			Help:     "Maximum burst of API calls over qps, 0 to use qps rounded up",
+			Default:  0,
+			Advanced: true,
+		},
+		{
+			Name:     "sync_interval",
+			Help:     "Minimum time between two honey sync listings of the backend, 0 to use the global --sync-interval",
+			Default:  fs.Duration(0),
+			Advanced: true,
+		},
+		{
+			Name:     "cache_ttl",
+			Help:     "How long the results of the backend are cached, 0 to use the global --cache-ttl",
+			Default:  fs.Duration(0),
+			Advanced: true,
+		},
+		{
+			Name:     "no_cache",
+			Help:     "Don't cache the results of the backend",
+			Default:  false,
+			Advanced: true,
+		},
+		{
+			Name:     "negative_cache_ttl",
+			Help:     "How long the searches which found nothing are cached, 0 to use the global --negative-cache-ttl",
+			Default:  fs.Duration(0),
+			Advanced: true,
+		},
+	}
 )
 
 type (
@@ -42,6 +101,7 @@ type (
 
 // Register backend
 func Register(info *RegInfo) {
+	info.Options = append(info.Options, commonOptions...)
 	info.Options.setValues()
 
 	if info.Prefix == "" {
@@ -135,6 +195,46 @@ func ConfigMap(backendInfo *RegInfo, configName string) (config *configmap.Map)
 	return config
 }
 
+// ConfigFingerprint returns a hash of the resolved options of the
+// backend, the common ones aside as they don't change the instances
+// found. It changes with the config, so the results of the previous
+// config aren't served from the cache.
+func ConfigFingerprint(backendInfo *RegInfo, m configmap.Getter) string {
+	common := make(map[string]struct{}, len(commonOptions))
+	for _, o := range commonOptions {
+		common[o.Name] = struct{}{}
+	}
+
+	names := make([]string, 0, len(backendInfo.Options))
+	for _, o := range backendInfo.Options {
+		if _, ok := common[o.Name]; !ok {
+			names = append(names, o.Name)
+		}
+	}
+
+	sort.Strings(names)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "type=%q\n", backendInfo.Name)
+	for _, name := range names {
+		if value, ok := m.Get(name); ok {
+			fmt.Fprintf(h, "%s=%q\n", name, value)
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:fingerprintLen]
+}
+
+// GetCommonOptions parses the options shared by all the backends
+func GetCommonOptions(m configmap.Mapper) (*CommonOptions, error) {
+	opt := new(CommonOptions)
+	if err := configstruct.Set(m, opt); err != nil {
+		return nil, err
+	}
+
+	return opt, nil
+}
+
 // GetValue gets the current current value which is the default if not set
 func (o *Option) GetValue() interface{} {
 	val := o.Value
@@ -271,38 +371,199 @@ func instanceFieldNames() []string {
 	return fields
 }
 
+// FlattenData returns the instances as json, the keys of the fields and
+// of the raw data are snake_case. The labels keep the keys of the
+// provider, e.g. the EC2 tag CostCenter is labels.CostCenter.
 func (p Printable) FlattenData() (*FlattenData, error) {
-	data := make([]map[string]interface{}, 0)
-	for _, i := range p {
-		modelData, err := ToMap(i)
+	buf := bytes.NewBufferString("[")
+	for n, i := range p {
+		d, err := i.flatten()
 		if err != nil {
 			return nil, err
 		}
 
-		data = append(data, modelData)
+		if n > 0 {
+			buf.WriteByte(',')
+		}
+
+		buf.Write(d)
 	}
 
-	marshaler := conjson.NewMarshaler(data, transform.ConventionalKeys())
+	buf.WriteByte(']')
 
-	d, err := jsoniter.Marshal(marshaler)
+	return &FlattenData{
+		Len:   len(p),
+		Bytes: buf.Bytes(),
+	}, nil
+}
+
+// flatten returns the json document of the instance, see FlattenData
+func (i *Instance) flatten() ([]byte, error) {
+	modelData, err := ToMap(i)
 	if err != nil {
 		return nil, err
 	}
 
-	return &FlattenData{
-		Len:   len(data),
-		Bytes: d,
-	}, nil
+	delete(modelData, "Labels")
+
+	d, err := jsoniter.Marshal(conjson.NewMarshaler(modelData, transform.ConventionalKeys()))
+	if err != nil {
+		return nil, err
+	}
+
+	labels, err := jsoniter.Marshal(i.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	// the map of the fields is never empty, the labels are added as its
+	// last key
+	buf := bytes.NewBuffer(d[:len(d)-1])
+	buf.WriteString(`,"labels":`)
+	buf.Write(labels)
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
 }
 
+// Values returns the values of the query field of the instance, raw
+// fields are looked up with a gjson path into the raw data
+func (i *Instance) Values(field string) []string {
+	switch field {
+	case query.FieldID:
+		return []string{i.ID}
+	case query.FieldBackend, query.FieldBackendName:
+		return []string{i.BackendName}
+	case query.FieldName:
+		return []string{i.Name}
+	case query.FieldType:
+		return []string{i.Type}
+	case query.FieldStatus:
+		return []string{i.Status}
+	case query.FieldPrivateIP:
+		return []string{i.PrivateIP}
+	case query.FieldPublicIP:
+		return []string{i.PublicIP}
+	case query.FieldIP:
+		return []string{i.PrivateIP, i.PublicIP}
+	case query.FieldRegion:
+		return []string{i.Region}
+	case query.FieldZone:
+		return []string{i.Zone}
+	case query.FieldAccount:
+		return []string{i.Account}
+	}
+
+	if strings.HasPrefix(field, query.FieldLabelsPrefix) {
+		key := strings.TrimPrefix(field, query.FieldLabelsPrefix)
+		for k, v := range i.Labels {
+			if strings.EqualFold(k, key) {
+				return []string{v}
+			}
+		}
+
+		return nil
+	}
+
+	if !strings.HasPrefix(field, query.FieldRawPrefix) {
+		return nil
+	}
+
+	raw, err := jsoniter.Marshal(conjson.NewMarshaler(i.Raw, transform.ConventionalKeys()))
+	if err != nil {
+		log.Debugf("can't marshal raw data of %s: %v", i.ID, err)
+
+		return nil
+	}
+
+	res := gjson.GetBytes(raw, strings.TrimPrefix(field, query.FieldRawPrefix))
+	if !res.Exists() {
+		return nil
+	}
+
+	if !res.IsArray() {
+		return []string{res.String()}
+	}
+
+	values := make([]string, 0)
+	for _, r := range res.Array() {
+		values = append(values, r.String())
+	}
+
+	return values
+}
+
+// MatchPattern returns true if the free text pattern matches the
+// instance, the id, the name or, for an ip address or a network, the
+// private or public ip. Backends may match more, e.g. all the network
+// interfaces, this is the part all of them share.
+func (i *Instance) MatchPattern(m *query.Matcher) bool {
+	if m.Pattern == "" || i.ID == m.Pattern {
+		return true
+	}
+
+	if network := query.ParseNetwork(m.Pattern); network != nil {
+		return query.NetworkContains(network, i.PrivateIP, i.PublicIP)
+	}
+
+	return m.Match(i.Name)
+}
+
+// Score returns how well the free text pattern matches the instance,
+// see query.Matcher.Score. The id and the ip addresses match exactly.
+func (i *Instance) Score(m *query.Matcher) float64 {
+	if m.Pattern == "" || i.ID == m.Pattern {
+		return 1
+	}
+
+	if network := query.ParseNetwork(m.Pattern); network != nil {
+		if query.NetworkContains(network, i.PrivateIP, i.PublicIP) {
+			return 1
+		}
+
+		return 0
+	}
+
+	return m.Score(i.Name)
+}
+
+// Match returns the instances which match all the terms
+func (p Printable) Match(terms query.Terms) Printable {
+	if len(terms) == 0 {
+		return p
+	}
+
+	matched := make(Printable, 0, len(p))
+	for _, i := range p {
+		if terms.Match(i.Values) {
+			matched = append(matched, i)
+		}
+	}
+
+	return matched
+}
+
+// Headers returns the instance fields, sources only if the instances
+// were merged and patterns only if several filters were searched
 func (p Printable) Headers() []string {
-	return instanceFieldNames()
+	headers := make([]string, 0)
+	for _, field := range instanceFieldNames() {
+		if field == "sources" && !p.merged() || field == "patterns" && !p.tagged() {
+			continue
+		}
+
+		headers = append(headers, field)
+	}
+
+	return headers
 }
 
 func (p Printable) Rows() [][]string {
-	rows := make([][]string, len(p))
+	merged, tagged := p.merged(), p.tagged()
+
+	rows := make([][]string, 0, len(p))
 	for _, i := range p {
-		rows = append(rows, []string{
+		row := []string{
 			i.ID,
 			i.BackendName,
 			i.Name,
@@ -310,12 +571,70 @@ func (p Printable) Rows() [][]string {
 			i.Status,
 			i.PrivateIP,
 			i.PublicIP,
-		})
+			i.Region,
+			i.Zone,
+			i.Account,
+			FormatTime(i.CreatedAt),
+			FormatLabels(i.Labels),
+		}
+
+		if merged {
+			row = append(row, strings.Join(i.Sources, ","))
+		}
+
+		if tagged {
+			row = append(row, strings.Join(i.Patterns, ","))
+		}
+
+		rows = append(rows, row)
 	}
 
 	return rows
 }
 
+// merged returns true if the instances were merged
+func (p Printable) merged() bool {
+	for _, i := range p {
+		if len(i.Sources) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tagged returns true if the instances were tagged with the patterns
+func (p Printable) tagged() bool {
+	for _, i := range p {
+		if len(i.Patterns) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FormatTime formats the time for the table output, nil is empty
+func FormatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+// FormatLabels formats the labels as sorted key=value pairs
+func FormatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
+
 func (d *FlattenData) ToArrayMap() ([]map[string]interface{}, error) {
 	data := make([]map[string]interface{}, 0)
 	if err := jsoniter.Unmarshal(d.Bytes, &data); err != nil {
@@ -344,6 +663,67 @@ func (d *FlattenData) Filter(keys []string) ([]map[string]interface{}, error) {
 	return cleanedData, nil
 }
 
+// Rows returns the values of the gjson paths of every instance, see
+// FormatValue
+func (d *FlattenData) Rows(paths []string) [][]string {
+	rows := make([][]string, 0, d.Len)
+	for i := 0; i < d.Len; i++ {
+		row := make([]string, len(paths))
+		for n, path := range paths {
+			row[n] = FormatValue(gjson.GetBytes(d.Bytes, fmt.Sprintf("%d.%s", i, path)))
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// FormatValue formats a value of the flattened data as a single cell.
+// Arrays of scalars are joined with commas and objects of scalars are
+// sorted key=value pairs, like the labels of the table, other nested
+// values are json. Missing and null values are empty.
+func FormatValue(v gjson.Result) string {
+	switch {
+	case !v.Exists() || v.Type == gjson.Null:
+		return ""
+	case v.IsArray():
+		values := make([]string, 0)
+		scalar := true
+		v.ForEach(func(_, item gjson.Result) bool {
+			scalar = !item.IsArray() && !item.IsObject()
+			values = append(values, item.String())
+
+			return scalar
+		})
+
+		if scalar {
+			return strings.Join(values, ",")
+		}
+
+		return v.Raw
+	case v.IsObject():
+		pairs := make([]string, 0)
+		scalar := true
+		v.ForEach(func(key, item gjson.Result) bool {
+			scalar = !item.IsArray() && !item.IsObject()
+			pairs = append(pairs, key.String()+"="+item.String())
+
+			return scalar
+		})
+
+		if !scalar {
+			return v.Raw
+		}
+
+		sort.Strings(pairs)
+
+		return strings.Join(pairs, ",")
+	}
+
+	return v.String()
+}
+
 func ToMap(m interface{}) (map[string]interface{}, error) {
 	data := make(map[string]interface{})
 	if err := mapstructure.Decode(m, &data); err != nil {
@@ -0,0 +1,77 @@
+package place
+
+import (
+	"testing"
+
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/tidwall/gjson"
+)
+
+func TestFlattenDataKeepsLabelKeys(t *testing.T) {
+	p := Printable{
+		{
+			Model: Model{ID: "i-1", BackendName: "aws", Labels: map[string]string{"CostCenter": "x", "Name": "api"}},
+			Raw:   map[string]interface{}{"InstanceType": "t3.micro"},
+		},
+		{
+			Model: Model{ID: "i-2", BackendName: "aws"},
+		},
+	}
+
+	d, err := p.FlattenData()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Len != 2 || !gjson.ValidBytes(d.Bytes) {
+		t.Fatalf("invalid flattened data %s", d.Bytes)
+	}
+
+	for path, want := range map[string]string{
+		"0.id":                "i-1",
+		"0.backend_name":      "aws",
+		"0.labels.CostCenter": "x",
+		"0.labels.Name":       "api",
+		"0.raw.instance_type": "t3.micro",
+		"1.id":                "i-2",
+	} {
+		if got := gjson.GetBytes(d.Bytes, path).String(); got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+
+	if labels := gjson.GetBytes(d.Bytes, "1.labels"); labels.Type != gjson.Null {
+		t.Errorf("1.labels = %s, want null", labels.Raw)
+	}
+}
+
+func TestConfigFingerprint(t *testing.T) {
+	info := &RegInfo{
+		Name:    "aws",
+		Options: append(Options{{Name: "region"}, {Name: "profile"}}, commonOptions...),
+	}
+
+	base := ConfigFingerprint(info, configmap.Simple{"region": "us-east-1", "profile": "prod"})
+	if len(base) != fingerprintLen {
+		t.Fatalf("got fingerprint %q, want %d characters", base, fingerprintLen)
+	}
+
+	for _, tc := range []struct {
+		name string
+		info *RegInfo
+		m    configmap.Simple
+		same bool
+	}{
+		{"same config", info, configmap.Simple{"profile": "prod", "region": "us-east-1"}, true},
+		{"common options", info, configmap.Simple{"region": "us-east-1", "profile": "prod", "timeout": "1m", "cache_ttl": "1h", "qps": "5"}, true},
+		{"unknown option", info, configmap.Simple{"region": "us-east-1", "profile": "prod", "unused": "x"}, true},
+		{"option changed", info, configmap.Simple{"region": "eu-west-1", "profile": "prod"}, false},
+		{"option unset", info, configmap.Simple{"region": "us-east-1"}, false},
+		{"option empty", info, configmap.Simple{"region": "us-east-1", "profile": ""}, false},
+		{"backend type", &RegInfo{Name: "gcp", Options: info.Options}, configmap.Simple{"region": "us-east-1", "profile": "prod"}, false},
+	} {
+		if got := ConfigFingerprint(tc.info, tc.m); (got == base) != tc.same {
+			t.Errorf("%s: got fingerprint %s, base %s, want same %v", tc.name, got, base, tc.same)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package printers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+// tsvEscaper escapes the characters which can't be in a tsv field
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// WriteCSV writes the rows as csv, quoted as needed by RFC 4180, the
+// headers first unless noHeaders is set
+func WriteCSV(w io.Writer, headers []string, rows [][]string, noHeaders bool) error {
+	cw := csv.NewWriter(w)
+	if !noHeaders {
+		if err := cw.Write(headers); err != nil {
+			return err
+		}
+	}
+
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+
+	return cw.Error()
+}
+
+// WriteTSV writes the rows as tab separated values, the tabs, newlines
+// and backslashes of the values are escaped with a backslash so every
+// line is a row, e.g. for awk -F'\t'
+func WriteTSV(w io.Writer, headers []string, rows [][]string, noHeaders bool) error {
+	bw := bufio.NewWriter(w)
+	if !noHeaders {
+		writeTSVLine(bw, headers)
+	}
+
+	for _, row := range rows {
+		writeTSVLine(bw, row)
+	}
+
+	return bw.Flush()
+}
+
+func writeTSVLine(w *bufio.Writer, fields []string) {
+	for n, field := range fields {
+		if n > 0 {
+			w.WriteByte('\t')
+		}
+
+		w.WriteString(tsvEscaper.Replace(field))
+	}
+
+	w.WriteByte('\n')
+}
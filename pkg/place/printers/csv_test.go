@@ -0,0 +1,118 @@
+package printers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bringg/honey/pkg/place"
+)
+
+var escapedRows = [][]string{
+	{"i-1", "api, web", `say "hi"`},
+	{"i-2", "two\nlines", ""},
+	{"i-3", `C:\tmp`, "tab\there"},
+	{"i-4", " padded ", "carriage\r\nreturn"},
+}
+
+func TestWriteCSV(t *testing.T) {
+	headers := []string{"ID", "NAME", "NOTE"}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, headers, escapedRows, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(buf.String(), "ID,NAME,NOTE\ni-1,\"api, web\",\"say \"\"hi\"\"\"\n") {
+		t.Errorf("got\n%s\nwant the fields with commas and quotes quoted", buf.String())
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the csv reader reads \r\n as \n in quoted fields
+	want := append([][]string{headers}, escapedRows...)
+	want[4] = []string{"i-4", " padded ", "carriage\nreturn"}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("read %q, want %q", records, want)
+	}
+
+	buf.Reset()
+	if err := WriteCSV(&buf, headers, escapedRows[:1], true); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := buf.String(); got != "i-1,\"api, web\",\"say \"\"hi\"\"\"\n" {
+		t.Errorf("got %q without headers", got)
+	}
+}
+
+func TestWriteTSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteTSV(&buf, []string{"ID", "NAME", "NOTE"}, escapedRows, false); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "ID\tNAME\tNOTE\n" +
+		"i-1\tapi, web\tsay \"hi\"\n" +
+		"i-2\ttwo\\nlines\t\n" +
+		"i-3\tC:\\\\tmp\ttab\\there\n" +
+		"i-4\t padded \tcarriage\\r\\nreturn\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%q\nwant\n%q", got, want)
+	}
+
+	// every line is a row of as many fields as the headers
+	unescape := strings.NewReplacer(`\\`, `\`, `\t`, "\t", `\n`, "\n", `\r`, "\r")
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	for n, line := range lines[1:] {
+		fields := strings.Split(line, "\t")
+		for f := range fields {
+			fields[f] = unescape.Replace(fields[f])
+		}
+
+		if !reflect.DeepEqual(fields, escapedRows[n]) {
+			t.Errorf("line %d is %q, want %q", n+1, fields, escapedRows[n])
+		}
+	}
+
+	buf.Reset()
+	if err := WriteTSV(&buf, []string{"ID"}, [][]string{{"i-1"}}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := buf.String(); got != "i-1\n" {
+		t.Errorf("got %q without headers", got)
+	}
+}
+
+func TestPrintCSVColumns(t *testing.T) {
+	data := place.Printable{
+		{Model: place.Model{ID: "i-1", BackendName: "aws", Name: "api", Labels: map[string]string{"Team": "core, infra"}}},
+		{Model: place.Model{ID: "i-2", BackendName: "aws", Name: "web"}},
+	}
+
+	out := captureStdout(t, func() {
+		if err := Print(&PrintInput{Data: data, Format: "csv=ID:id,TEAM:labels.Team"}); err != nil {
+			t.Error(err)
+		}
+	})
+
+	if want := "ID,TEAM\ni-1,\"core, infra\"\ni-2,\n"; out != want {
+		t.Errorf("got\n%q\nwant\n%q", out, want)
+	}
+
+	out = captureStdout(t, func() {
+		if err := Print(&PrintInput{Data: data, Format: "tsv=id,name", NoHeaders: true}); err != nil {
+			t.Error(err)
+		}
+	})
+
+	if want := "i-1\tapi\ni-2\tweb\n"; out != want {
+		t.Errorf("got\n%q\nwant\n%q", out, want)
+	}
+}
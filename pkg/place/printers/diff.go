@@ -0,0 +1,161 @@
+package printers
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+	"github.com/rclone/rclone/fs"
+	"github.com/tidwall/pretty"
+
+	"github.com/bringg/honey/pkg/place"
+)
+
+// diffEntry is a change of the json output of a diff
+type diffEntry struct {
+	Change   place.ChangeType              `json:"change"`
+	Instance map[string]interface{}        `json:"instance"`
+	Changes  map[string]*place.FieldChange `json:"changes,omitempty"`
+}
+
+// diffHeaders are the columns of the diff table and markdown outputs
+var diffHeaders = []string{"change", "backend_name", "id", "name", "field", "from", "to"}
+
+// PrintDiff prints the changes between two inventories as a table,
+// json or a markdown table, the json instances keys are set with
+// json=keys
+func PrintDiff(i *PrintInput, changes []*place.Change) error {
+	parts := strings.SplitN(i.Format, "=", 2)
+	switch parts[0] {
+	case "table":
+		if len(changes) == 0 {
+			fmt.Println("no changes")
+
+			return nil
+		}
+
+		printTable(diffHeaders, diffRows(changes))
+		fmt.Println(diffSummary(changes))
+
+		return nil
+	case "markdown", "md":
+		return printMarkdownDiff(changes)
+	case "json":
+		headers := place.Printable{}.Headers()
+		if len(parts) == 2 {
+			h := fs.CommaSepList{}
+			h.Set(parts[1])
+			if len(h) > 0 {
+				headers = h
+			}
+		}
+
+		return printJSONDiff(changes, headers, i.NoColor)
+	}
+
+	return errors.Errorf("unsupported diff output %q, must be one of table|json|markdown", parts[0])
+}
+
+// diffRows returns a row per changed field, a single one for the
+// instances added or removed
+func diffRows(changes []*place.Change) [][]string {
+	rows := make([][]string, 0, len(changes))
+	for _, c := range changes {
+		i := c.Instance
+		if c.Type != place.ChangeUpdated {
+			rows = append(rows, []string{string(c.Type), i.BackendName, i.ID, i.Name, "", "", ""})
+
+			continue
+		}
+
+		for _, field := range changedFields(c) {
+			fc := c.Fields[field]
+			rows = append(rows, []string{string(c.Type), i.BackendName, i.ID, i.Name, field, fc.From, fc.To})
+		}
+	}
+
+	return rows
+}
+
+// changedFields returns the fields of the change, sorted
+func changedFields(c *place.Change) []string {
+	fields := make([]string, 0, len(c.Fields))
+	for field := range c.Fields {
+		fields = append(fields, field)
+	}
+
+	sort.Strings(fields)
+
+	return fields
+}
+
+// diffSummary counts the changes by type
+func diffSummary(changes []*place.Change) string {
+	counts := make(map[place.ChangeType]int)
+	for _, c := range changes {
+		counts[c.Type]++
+	}
+
+	return fmt.Sprintf("%d added, %d removed, %d changed", counts[place.ChangeAdded], counts[place.ChangeRemoved], counts[place.ChangeUpdated])
+}
+
+func printMarkdownDiff(changes []*place.Change) error {
+	b := new(strings.Builder)
+	fmt.Fprintf(b, "**%s**\n\n", diffSummary(changes))
+
+	if len(changes) > 0 {
+		fmt.Fprintf(b, "| %s |\n", strings.Join(diffHeaders, " | "))
+		fmt.Fprintf(b, "|%s\n", strings.Repeat(" --- |", len(diffHeaders)))
+
+		for _, row := range diffRows(changes) {
+			cells := make([]string, len(row))
+			for n, cell := range row {
+				cells[n] = strings.ReplaceAll(cell, "|", `\|`)
+			}
+
+			fmt.Fprintf(b, "| %s |\n", strings.Join(cells, " | "))
+		}
+	}
+
+	_, err := fmt.Fprint(os.Stdout, b.String())
+
+	return err
+}
+
+func printJSONDiff(changes []*place.Change, headers []string, noColor bool) error {
+	entries := make([]*diffEntry, len(changes))
+	for n, c := range changes {
+		flattenData, err := place.Printable{c.Instance}.FlattenData()
+		if err != nil {
+			return err
+		}
+
+		cleanedData, err := flattenData.Filter(headers)
+		if err != nil {
+			return err
+		}
+
+		entries[n] = &diffEntry{
+			Change:   c.Type,
+			Instance: cleanedData[0],
+			Changes:  c.Fields,
+		}
+	}
+
+	out, err := jsoniter.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	out = pretty.Pretty(out)
+	if !noColor {
+		out = pretty.Color(out, nil)
+	}
+
+	_, err = os.Stdout.Write(out)
+
+	return err
+}
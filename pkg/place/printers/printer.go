@@ -22,12 +22,32 @@ type (
 		Data    Printable
 		Format  string
 		NoColor bool
+		// NoHeaders skips the header line of the csv and tsv outputs
+		NoHeaders bool
+		// GroupBy is the gjson path the table, json and yaml outputs
+		// are grouped by, if set
+		GroupBy string
 	}
 
 	Printable interface {
 		FlattenData() (*place.FlattenData, error)
 		Headers() []string
 		Rows() [][]string
+		GroupBy(path string) []*place.Group
+	}
+
+	// column is a column of the table output, the value of the gjson
+	// path of the flattened instances
+	column struct {
+		Header string
+		Path   string
+	}
+
+	// group is a group of instances of the json and yaml outputs
+	group struct {
+		Group     string                   `json:"group" yaml:"group"`
+		Count     int                      `json:"count" yaml:"count"`
+		Instances []map[string]interface{} `json:"instances" yaml:"instances"`
 	}
 )
 
@@ -56,10 +76,17 @@ func Print(i *PrintInput) error {
 		return err
 	}
 
+	var output interface{} = cleanedData
+	if i.GroupBy != "" && (parts[0] == "json" || parts[0] == "yaml") {
+		if output, err = groupData(i.Data, i.GroupBy, headers); err != nil {
+			return err
+		}
+	}
+
 	var out []byte
 	switch parts[0] {
 	case "json":
-		out, err = jsoniter.Marshal(cleanedData)
+		out, err = jsoniter.Marshal(output)
 		if err != nil {
 			return err
 		}
@@ -69,7 +96,7 @@ func Print(i *PrintInput) error {
 			out = pretty.Color(out, nil)
 		}
 	case "yaml":
-		out, err = yaml.Marshal(cleanedData)
+		out, err = yaml.Marshal(output)
 		if err != nil {
 			return err
 		}
@@ -94,20 +121,39 @@ func Print(i *PrintInput) error {
 		}
 
 		out = buf.Bytes()
+	case "ndjson":
+		return printNDJSON(i.Data, headers)
 	case "table":
-		rows := i.Data.Rows()
+		columns := parseColumns(expr)
+		if i.GroupBy != "" {
+			return printGroupedTable(i.Data, i.GroupBy, columns)
+		}
+
+		headers, rows, err := tableData(i.Data, columns)
+		if err != nil {
+			return err
+		}
+
 		if len(rows) == 0 {
 			fmt.Println("no instances found")
 
 			return nil
 		}
 
-		table := tablewriter.NewWriter(os.Stdout)
-		table.SetHeader(headers)
-		table.AppendBulk(rows)
-		table.Render()
+		printTable(headers, rows)
 
 		return nil
+	case "csv", "tsv":
+		headers, rows, err := tableData(i.Data, parseColumns(expr))
+		if err != nil {
+			return err
+		}
+
+		if parts[0] == "tsv" {
+			return WriteTSV(os.Stdout, headers, rows, i.NoHeaders)
+		}
+
+		return WriteCSV(os.Stdout, headers, rows, i.NoHeaders)
 	}
 
 	fmt.Fprint(os.Stdout, string(out))
@@ -115,10 +161,125 @@ func Print(i *PrintInput) error {
 	return nil
 }
 
+func printTable(headers []string, rows [][]string) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(headers)
+	table.AppendBulk(rows)
+	table.Render()
+}
+
+// parseColumns parses the columns of table=cols, NAME:path sets the
+// header of a path, the path is its header otherwise. The columns are
+// nil if there are none, for the default ones.
+func parseColumns(spec string) []*column {
+	list := fs.CommaSepList{}
+	list.Set(spec)
+	if len(list) == 0 {
+		return nil
+	}
+
+	columns := make([]*column, len(list))
+	for n, item := range list {
+		c := &column{Header: item, Path: item}
+		if parts := strings.SplitN(item, ":", 2); len(parts) == 2 && parts[0] != "" && parts[1] != "" {
+			c.Header, c.Path = parts[0], parts[1]
+		}
+
+		columns[n] = c
+	}
+
+	return columns
+}
+
+// tableData returns the headers and the rows of the columns, the
+// default ones if nil
+func tableData(data Printable, columns []*column) ([]string, [][]string, error) {
+	if columns == nil {
+		return data.Headers(), data.Rows(), nil
+	}
+
+	paths := make([]string, len(columns))
+	for n, c := range columns {
+		paths[n] = c.Path
+	}
+
+	flattenData, err := data.FlattenData()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return columnHeaders(columns), flattenData.Rows(paths), nil
+}
+
+// columnHeaders returns the headers of the columns
+func columnHeaders(columns []*column) []string {
+	headers := make([]string, len(columns))
+	for n, c := range columns {
+		headers[n] = c.Header
+	}
+
+	return headers
+}
+
+// printGroupedTable prints a table per group under a header with the
+// group key and count
+func printGroupedTable(data Printable, path string, columns []*column) error {
+	groups := data.GroupBy(path)
+	if len(groups) == 0 {
+		fmt.Println("no instances found")
+
+		return nil
+	}
+
+	for n, g := range groups {
+		if n > 0 {
+			fmt.Println()
+		}
+
+		key := g.Key
+		if key == "" {
+			key = "<none>"
+		}
+
+		headers, rows, err := tableData(g.Instances, columns)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s: %s (%d)\n", path, key, len(g.Instances))
+		printTable(headers, rows)
+	}
+
+	return nil
+}
+
+// groupData returns the groups of the json and yaml outputs
+func groupData(data Printable, path string, headers []string) ([]*group, error) {
+	groups := make([]*group, 0)
+	for _, g := range data.GroupBy(path) {
+		flattenData, err := g.Instances.FlattenData()
+		if err != nil {
+			return nil, err
+		}
+
+		cleanedData, err := flattenData.Filter(headers)
+		if err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, &group{
+			Group:     g.Key,
+			Count:     len(g.Instances),
+			Instances: cleanedData,
+		})
+	}
+
+	return groups, nil
+}
+
 // IsHeaderble _
-// table not supported yet
 func IsHeaderble(format string) bool {
-	if format == "json" || format == "yaml" || format == "jsonpath" {
+	if format == "json" || format == "yaml" || format == "jsonpath" || format == "ndjson" || format == "table" || format == "csv" || format == "tsv" {
 		return true
 	}
 
@@ -0,0 +1,199 @@
+package printers
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/olekukonko/tablewriter"
+	"github.com/rclone/rclone/fs"
+	"golang.org/x/term"
+
+	"github.com/bringg/honey/pkg/place"
+)
+
+type (
+	// StreamPrinter prints the instances as the backends find them
+	StreamPrinter interface {
+		// Page prints a page of instances
+		Page(page place.Printable)
+		// Close prints all the instances found if the format needs it
+		// and returns the first error of the printer
+		Close(data Printable) error
+	}
+
+	// bufferedPrinter prints the formats which can't be printed
+	// incrementally once the search is done
+	bufferedPrinter struct {
+		input *PrintInput
+	}
+
+	// ndjsonPrinter prints an instance per line as json
+	ndjsonPrinter struct {
+		headers []string // nil for the default ones
+		pages   int
+		err     error
+	}
+
+	// liveTablePrinter re-renders the table found so far on every
+	// page, the final table replaces it
+	liveTablePrinter struct {
+		input   *PrintInput
+		columns []*column // nil for the default ones
+		found   place.Printable
+		lines   int
+		height  int
+	}
+)
+
+// NewStreamPrinter returns the printer of the format, ndjson is
+// printed a line per instance and table is re-rendered as the pages
+// arrive when stdout is a terminal. The other formats are printed by
+// Print on Close.
+func NewStreamPrinter(i *PrintInput) StreamPrinter {
+	parts := strings.SplitN(i.Format, "=", 2)
+	switch parts[0] {
+	case "ndjson":
+		p := new(ndjsonPrinter)
+		if len(parts) == 2 {
+			h := fs.CommaSepList{}
+			h.Set(parts[1])
+			if len(h) > 0 {
+				p.headers = h
+			}
+		}
+
+		return p
+	case "table":
+		fd := int(os.Stdout.Fd())
+		if !term.IsTerminal(fd) {
+			break
+		}
+
+		_, height, err := term.GetSize(fd)
+		if err != nil {
+			break
+		}
+
+		p := &liveTablePrinter{
+			input:  i,
+			height: height,
+		}
+
+		if len(parts) == 2 {
+			p.columns = parseColumns(parts[1])
+		}
+
+		return p
+	}
+
+	return &bufferedPrinter{input: i}
+}
+
+func (p *bufferedPrinter) Page(place.Printable) {}
+
+func (p *bufferedPrinter) Close(data Printable) error {
+	in := *p.input
+	in.Data = data
+
+	return Print(&in)
+}
+
+func (p *ndjsonPrinter) Page(page place.Printable) {
+	p.pages++
+	if p.err != nil {
+		return
+	}
+
+	p.err = printNDJSON(page, p.headers)
+}
+
+// Close prints the instances if none were streamed, e.g. when they
+// were merged
+func (p *ndjsonPrinter) Close(data Printable) error {
+	if p.err != nil || p.pages > 0 {
+		return p.err
+	}
+
+	return printNDJSON(data, p.headers)
+}
+
+// printNDJSON prints the instances a line each, nil headers are the
+// default ones of the data
+func printNDJSON(data Printable, headers []string) error {
+	if headers == nil {
+		headers = data.Headers()
+	}
+
+	flattenData, err := data.FlattenData()
+	if err != nil {
+		return err
+	}
+
+	cleanedData, err := flattenData.Filter(headers)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range cleanedData {
+		line, err := jsoniter.Marshal(item)
+		if err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintln(os.Stdout, string(line)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *liveTablePrinter) Page(page place.Printable) {
+	p.found = append(p.found, page...)
+
+	// the default headers depend on the instances, e.g. the patterns of
+	// the tagged ones
+	headers, rows, err := tableData(p.found, p.columns)
+	if err != nil {
+		// the final table reports it
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	table := tablewriter.NewWriter(buf)
+	table.SetHeader(headers)
+	table.AppendBulk(rows)
+	table.Render()
+
+	// a table taller than the terminal can't be erased
+	out := buf.String()
+	if strings.Count(out, "\n") >= p.height {
+		out = fmt.Sprintf("found %d instances, searching...\n", len(rows))
+	}
+
+	p.erase()
+	fmt.Fprint(os.Stdout, out)
+	p.lines = strings.Count(out, "\n")
+}
+
+func (p *liveTablePrinter) Close(data Printable) error {
+	p.erase()
+
+	in := *p.input
+	in.Data = data
+
+	return Print(&in)
+}
+
+// erase moves the cursor up to the first line printed and clears the
+// screen from there
+func (p *liveTablePrinter) erase() {
+	if p.lines > 0 {
+		fmt.Fprintf(os.Stdout, "\033[%dA\033[J", p.lines)
+	}
+
+	p.lines = 0
+}
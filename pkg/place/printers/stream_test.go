@@ -0,0 +1,56 @@
+package printers
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bringg/honey/pkg/place"
+)
+
+// captureStdout returns what fn prints on stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() {
+		os.Stdout = stdout
+	}()
+
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+
+	fn()
+	w.Close()
+
+	return <-out
+}
+
+func TestLiveTableTaggedHeaders(t *testing.T) {
+	p := &liveTablePrinter{input: &PrintInput{Format: "table"}, height: 100}
+
+	out := captureStdout(t, func() {
+		p.Page(place.Printable{
+			{Model: place.Model{ID: "i-1", BackendName: "aws", Name: "api", Patterns: []string{"api"}}},
+		})
+	})
+
+	lines := strings.Split(out, "\n")
+	if len(lines) < 4 || !strings.Contains(lines[1], "PATTERNS") {
+		t.Fatalf("no patterns header in\n%s", out)
+	}
+
+	if header, row := strings.Count(lines[1], "|"), strings.Count(lines[3], "|"); header != row {
+		t.Errorf("the header has %d columns and the row %d\n%s", header-1, row-1, out)
+	}
+}
@@ -0,0 +1,188 @@
+package printers
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/olekukonko/tablewriter"
+	"github.com/rclone/rclone/fs"
+	"golang.org/x/term"
+
+	"github.com/bringg/honey/pkg/place"
+)
+
+type (
+	// WatchPrinter prints the instances and their changes on every
+	// search of a watch
+	WatchPrinter interface {
+		Print(t time.Time, data place.Printable, changes []*place.Change, first bool) error
+	}
+
+	// eventsPrinter prints a json line per change, for scripts
+	eventsPrinter struct {
+		headers []string // nil for the default ones
+	}
+
+	// watchTablePrinter redraws the table on every search with the
+	// changes highlighted, like watch(1)
+	watchTablePrinter struct {
+		title   string
+		noColor bool
+	}
+
+	// event is a change of the events output
+	event struct {
+		Time     time.Time                     `json:"time"`
+		Event    place.ChangeType              `json:"event"`
+		Instance map[string]interface{}        `json:"instance"`
+		Changes  map[string]*place.FieldChange `json:"changes,omitempty"`
+	}
+)
+
+// watchHeaders are the columns of the watch table
+var watchHeaders = []string{"change", "backend_name", "id", "name", "status", "private_ip", "public_ip"}
+
+// NewWatchPrinter returns the live table printer if the format is table
+// and stdout is a terminal, the events printer otherwise. The events
+// keys are set with ndjson=keys. title is shown above the table.
+func NewWatchPrinter(i *PrintInput, title string) WatchPrinter {
+	parts := strings.SplitN(i.Format, "=", 2)
+	if parts[0] == "table" && term.IsTerminal(int(os.Stdout.Fd())) {
+		return &watchTablePrinter{
+			title:   title,
+			noColor: i.NoColor,
+		}
+	}
+
+	p := new(eventsPrinter)
+	if parts[0] == "ndjson" && len(parts) == 2 {
+		h := fs.CommaSepList{}
+		h.Set(parts[1])
+		if len(h) > 0 {
+			p.headers = h
+		}
+	}
+
+	return p
+}
+
+func (p *eventsPrinter) Print(t time.Time, data place.Printable, changes []*place.Change, first bool) error {
+	for _, c := range changes {
+		headers := p.headers
+		if headers == nil {
+			headers = data.Headers()
+		}
+
+		flattenData, err := place.Printable{c.Instance}.FlattenData()
+		if err != nil {
+			return err
+		}
+
+		cleanedData, err := flattenData.Filter(headers)
+		if err != nil {
+			return err
+		}
+
+		line, err := jsoniter.Marshal(&event{
+			Time:     t,
+			Event:    c.Type,
+			Instance: cleanedData[0],
+			Changes:  c.Fields,
+		})
+		if err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintln(os.Stdout, string(line)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *watchTablePrinter) Print(t time.Time, data place.Printable, changes []*place.Change, first bool) error {
+	byKey := make(map[string]*place.Change, len(changes))
+	counts := make(map[place.ChangeType]int)
+	for _, c := range changes {
+		byKey[c.Instance.Key()] = c
+		counts[c.Type]++
+	}
+
+	// clear the screen and move the cursor home
+	fmt.Fprint(os.Stdout, "\033[H\033[2J")
+	fmt.Fprintf(os.Stdout, "%s\t%s\n", p.title, t.Format(time.RFC1123))
+
+	if first {
+		fmt.Fprintf(os.Stdout, "%d instances\n\n", len(data))
+	} else {
+		fmt.Fprintf(os.Stdout, "%d instances, %d added, %d removed, %d changed\n\n", len(data), counts[place.ChangeAdded], counts[place.ChangeRemoved], counts[place.ChangeUpdated])
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(watchHeaders)
+
+	for _, i := range data {
+		c := byKey[i.Key()]
+		if first {
+			c = nil
+		}
+
+		p.append(table, i, c)
+	}
+
+	// removed instances are shown until the next search
+	for _, c := range changes {
+		if c.Type == place.ChangeRemoved {
+			p.append(table, c.Instance, c)
+		}
+	}
+
+	table.Render()
+
+	return nil
+}
+
+// append appends the row of the instance, colored by its change
+func (p *watchTablePrinter) append(table *tablewriter.Table, i *place.Instance, c *place.Change) {
+	row := []string{"", i.BackendName, i.ID, i.Name, i.Status, i.PrivateIP, i.PublicIP}
+	colors := make([]tablewriter.Colors, len(row))
+
+	if c != nil {
+		var color tablewriter.Colors
+		switch c.Type {
+		case place.ChangeAdded:
+			row[0], color = "+", tablewriter.Colors{tablewriter.FgGreenColor}
+		case place.ChangeRemoved:
+			row[0], color = "-", tablewriter.Colors{tablewriter.FgRedColor}
+		case place.ChangeUpdated:
+			row[0] = "~"
+		}
+
+		for n := range row {
+			colors[n] = color
+		}
+
+		// only the changed fields of a changed instance are
+		// highlighted, with their previous value
+		for field, fc := range c.Fields {
+			for n, h := range watchHeaders {
+				if h == field {
+					row[n] = fmt.Sprintf("%s (was %s)", fc.To, fc.From)
+					colors[n] = tablewriter.Colors{tablewriter.Bold, tablewriter.FgYellowColor}
+				}
+			}
+		}
+	}
+
+	if p.noColor {
+		table.Append(row)
+
+		return
+	}
+
+	table.Rich(row, colors)
+}
@@ -0,0 +1,124 @@
+package query
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Fuzzy match scores, the best match of the name wins. Within a level
+// the closer the lengths of the pattern and the name the higher the
+// score.
+const (
+	scoreExact        = 1.0
+	scorePrefix       = 0.8
+	scoreWordBoundary = 0.6
+	scoreSubstring    = 0.4
+	scoreEditDistance = 0.2
+	// scoreLevel is the range of the length bonus within a level
+	scoreLevel = 0.1
+)
+
+// Score returns how well the name matches the pattern, from 1 for an
+// exact match down to 0 for no match: exact, prefix, word boundary,
+// substring and then edit distance of a word of the name. Fuzzy
+// matches are case insensitive. An empty pattern matches everything.
+func (m *Matcher) Score(name string) float64 {
+	pattern := strings.ToLower(m.Pattern)
+	name = strings.ToLower(name)
+
+	if pattern == "" || pattern == name {
+		return scoreExact
+	}
+
+	if name == "" {
+		return 0
+	}
+
+	bonus := scoreLevel * float64(len(pattern)) / float64(len(name))
+
+	switch {
+	case strings.HasPrefix(name, pattern):
+		return scorePrefix + bonus
+	case atWordBoundary(name, pattern):
+		return scoreWordBoundary + bonus
+	case strings.Contains(name, pattern):
+		return scoreSubstring + bonus
+	}
+
+	// a third of the pattern may be mistyped
+	maxDistance := len([]rune(pattern)) / 3
+	if maxDistance == 0 {
+		return 0
+	}
+
+	best := maxDistance + 1
+	for _, word := range append(words(name), name) {
+		if d := editDistance(pattern, word); d < best {
+			best = d
+		}
+	}
+
+	if best > maxDistance {
+		return 0
+	}
+
+	return scoreEditDistance * (1 - float64(best)/float64(maxDistance+1))
+}
+
+// atWordBoundary returns true if the pattern starts a word of the name
+func atWordBoundary(name, pattern string) bool {
+	for i := 1; i < len(name); i++ {
+		if isSeparator(rune(name[i-1])) && strings.HasPrefix(name[i:], pattern) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// words splits the name on the separators, e.g. api-gateway-1
+func words(name string) []string {
+	return strings.FieldsFunc(name, isSeparator)
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// editDistance returns the Levenshtein distance of a and b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev, cur = cur, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+
+	return m
+}
@@ -0,0 +1,90 @@
+package query
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestScoreRanking(t *testing.T) {
+	m, err := NewMatcher("api", MatchFuzzy, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// best first: exact, prefix, word boundary, substring, edit distance
+	ranked := []string{"API", "api-1", "api-gateway", "my-api", "rapid-worker", "apx-worker"}
+
+	shuffled := []string{"rapid-worker", "api-gateway", "apx-worker", "my-api", "API", "api-1"}
+	sort.SliceStable(shuffled, func(a, b int) bool {
+		return m.Score(shuffled[a]) > m.Score(shuffled[b])
+	})
+
+	for n, name := range ranked {
+		if shuffled[n] != name {
+			t.Fatalf("got the ranking %v, want %v", shuffled, ranked)
+		}
+	}
+
+	for n := 1; n < len(ranked); n++ {
+		if m.Score(ranked[n-1]) == m.Score(ranked[n]) {
+			t.Errorf("%s and %s have the same score", ranked[n-1], ranked[n])
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		min     float64
+		max     float64
+	}{
+		{"", "anything", scoreExact, scoreExact},
+		{"api", "api", scoreExact, scoreExact},
+		{"api", "api-gateway", scorePrefix, scorePrefix + scoreLevel},
+		{"api", "my-api", scoreWordBoundary, scoreWordBoundary + scoreLevel},
+		{"api", "my_api_1", scoreWordBoundary, scoreWordBoundary + scoreLevel},
+		{"api", "rapid", scoreSubstring, scoreSubstring + scoreLevel},
+		{"gateway", "api-gatewya", 0.01, scoreEditDistance},
+		{"gateway", "api-gtwy", 0, 0},
+		// too short to be mistyped
+		{"ab", "ax", 0, 0},
+		{"api", "", 0, 0},
+	}
+
+	for _, tt := range tests {
+		m, err := NewMatcher(tt.pattern, MatchFuzzy, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := m.Score(tt.name); got < tt.min || got > tt.max {
+			t.Errorf("Score(%q) of %q = %v, want within [%v, %v]", tt.name, tt.pattern, got, tt.min, tt.max)
+		}
+
+		if got, want := m.Match(tt.name), tt.max > 0; got != want {
+			t.Errorf("Match(%q) of %q = %v, want %v", tt.name, tt.pattern, got, want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"api", "", 3},
+		{"api", "api", 0},
+		{"api", "apx", 1},
+		{"api", "pai", 2},
+		{"gateway", "gatewya", 2},
+		{"kitten", "sitting", 3},
+	}
+
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
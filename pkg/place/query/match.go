@@ -0,0 +1,157 @@
+package query
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Match modes of the free text pattern
+const (
+	MatchSubstring MatchMode = "substring"
+	MatchPrefix    MatchMode = "prefix"
+	MatchExact     MatchMode = "exact"
+	MatchGlob      MatchMode = "glob"
+	MatchRegex     MatchMode = "regex"
+	MatchFuzzy     MatchMode = "fuzzy"
+)
+
+// MatchModes is the list of the supported match modes
+var MatchModes = []MatchMode{MatchSubstring, MatchPrefix, MatchExact, MatchGlob, MatchRegex, MatchFuzzy}
+
+type (
+	// MatchMode is how the pattern is matched against the instance name
+	MatchMode string
+
+	// Matcher matches the instance names the same way for all the
+	// backends, backends use Regexp or Glob to push it down
+	Matcher struct {
+		Pattern    string
+		Mode       MatchMode
+		IgnoreCase bool
+
+		re *regexp.Regexp
+	}
+)
+
+// ParseMatchMode parses the match mode, empty is substring
+func ParseMatchMode(s string) (MatchMode, error) {
+	if s == "" {
+		return MatchSubstring, nil
+	}
+
+	for _, mode := range MatchModes {
+		if string(mode) == strings.ToLower(s) {
+			return mode, nil
+		}
+	}
+
+	return "", errors.Errorf("unknown match mode %q, use one of %v", s, MatchModes)
+}
+
+// NewMatcher returns the matcher of the pattern
+func NewMatcher(pattern string, mode MatchMode, ignoreCase bool) (*Matcher, error) {
+	mode, err := ParseMatchMode(string(mode))
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Matcher{
+		Pattern:    pattern,
+		Mode:       mode,
+		IgnoreCase: ignoreCase,
+	}
+
+	if m.re, err = regexp.Compile(m.Regexp()); err != nil {
+		return nil, errors.Wrap(err, "failed to compile regular expression from pattern")
+	}
+
+	return m, nil
+}
+
+// Match returns true if the name matches the pattern
+func (m *Matcher) Match(name string) bool {
+	if m.Mode == MatchFuzzy {
+		return m.Score(name) > 0
+	}
+
+	return m.re.MatchString(name)
+}
+
+// Regexp returns the RE2 expression of the pattern, it is anchored so
+// it can be used by providers which search or fully match regexps.
+// Fuzzy matches can't be expressed as a regexp, it matches everything.
+func (m *Matcher) Regexp() string {
+	var expr string
+	switch m.Mode {
+	case MatchFuzzy:
+		expr = ".*"
+	case MatchPrefix:
+		expr = regexp.QuoteMeta(m.Pattern) + ".*"
+	case MatchExact:
+		expr = regexp.QuoteMeta(m.Pattern)
+	case MatchGlob:
+		expr = globToRegexp(m.Pattern)
+	case MatchRegex:
+		expr = ".*(?:" + m.Pattern + ").*"
+	default:
+		expr = ".*" + regexp.QuoteMeta(m.Pattern) + ".*"
+	}
+
+	flags := "(?s)"
+	if m.IgnoreCase {
+		flags = "(?is)"
+	}
+
+	return flags + "^(?:" + expr + ")$"
+}
+
+// Glob returns the pattern as a wildcard expression, `*` and `?`, as
+// supported by e.g. EC2 filters. Wildcards are case sensitive, ok is
+// false if the pattern can't be expressed this way.
+func (m *Matcher) Glob() (glob string, ok bool) {
+	if m.IgnoreCase {
+		return "", false
+	}
+
+	escaped := strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`).Replace(m.Pattern)
+	switch m.Mode {
+	case MatchPrefix:
+		return escaped + "*", true
+	case MatchExact:
+		return escaped, true
+	case MatchGlob:
+		return m.Pattern, true
+	case MatchRegex, MatchFuzzy:
+		return "", false
+	default:
+		return "*" + escaped + "*", true
+	}
+}
+
+// String returns the mode and the case sensitivity of the matcher
+func (m *Matcher) String() string {
+	if m.IgnoreCase {
+		return string(m.Mode) + "/i"
+	}
+
+	return string(m.Mode)
+}
+
+// globToRegexp converts a `*` and `?` wildcard expression to a regexp
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	return b.String()
+}
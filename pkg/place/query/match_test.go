@@ -0,0 +1,110 @@
+package query
+
+import (
+	"testing"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob string
+		want string
+	}{
+		{"api", "api"},
+		{"api-*", "api-.*"},
+		{"db-?", "db-."},
+		{"*.example.com", `.*\.example\.com`},
+		{"a+b(c)", `a\+b\(c\)`},
+	}
+
+	for _, tt := range tests {
+		if got := globToRegexp(tt.glob); got != tt.want {
+			t.Errorf("globToRegexp(%q) = %q, want %q", tt.glob, got, tt.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		mode       MatchMode
+		ignoreCase bool
+		name       string
+		want       bool
+	}{
+		{"api", MatchSubstring, false, "rapid-worker", true},
+		{"api", MatchSubstring, false, "RAPID", false},
+		{"api", MatchSubstring, true, "RAPID", true},
+		{"api", MatchPrefix, false, "api-gateway", true},
+		{"api", MatchPrefix, false, "my-api", false},
+		{"api", MatchExact, false, "api", true},
+		{"api", MatchExact, false, "api-1", false},
+		{"api-*", MatchGlob, false, "api-1", true},
+		{"api-*", MatchGlob, false, "my-api-1", false},
+		{"db-?", MatchGlob, false, "db-1", true},
+		{"db-?", MatchGlob, false, "db-10", false},
+		{"a.c", MatchGlob, false, "abc", false},
+		{"^api-[0-9]+$", MatchRegex, false, "api-12", true},
+		{"api|db", MatchRegex, false, "my-db", true},
+		{"a.c", MatchSubstring, false, "abc", false},
+	}
+
+	for _, tt := range tests {
+		m, err := NewMatcher(tt.pattern, tt.mode, tt.ignoreCase)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := m.Match(tt.name); got != tt.want {
+			t.Errorf("%s match %q of %q = %v, want %v", m, tt.name, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestGlob(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		mode       MatchMode
+		ignoreCase bool
+		want       string
+		ok         bool
+	}{
+		{"api", MatchSubstring, false, "*api*", true},
+		{"a*b", MatchSubstring, false, `*a\*b*`, true},
+		{"api", MatchPrefix, false, "api*", true},
+		{"a?", MatchExact, false, `a\?`, true},
+		{"api-*", MatchGlob, false, "api-*", true},
+		{"api", MatchSubstring, true, "", false},
+		{"api", MatchRegex, false, "", false},
+		{"api", MatchFuzzy, false, "", false},
+	}
+
+	for _, tt := range tests {
+		m, err := NewMatcher(tt.pattern, tt.mode, tt.ignoreCase)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, ok := m.Glob(); got != tt.want || ok != tt.ok {
+			t.Errorf("%s Glob() of %q = %q, %v, want %q, %v", m, tt.pattern, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNewMatcherErrors(t *testing.T) {
+	if _, err := NewMatcher("api", "bogus", false); err == nil {
+		t.Error("no error for an unknown match mode")
+	}
+
+	if _, err := NewMatcher("api(", MatchRegex, false); err == nil {
+		t.Error("no error for an invalid regexp")
+	}
+
+	m, err := NewMatcher("api(", MatchSubstring, false)
+	if err != nil {
+		t.Fatalf("got %v for a substring of regexp characters", err)
+	}
+
+	if !m.Match("my-api(1)") {
+		t.Error("the substring isn't matched literally")
+	}
+}
@@ -0,0 +1,393 @@
+// Package query implements the small query language used to search
+// the instances, e.g.
+//
+//	api status=running backend=aws private_ip=10.1.0.0/16 name!~canary
+//
+// A query is made of a free text pattern, which is handed to the
+// backends as is, and of terms which are ANDed together. Terms are
+// evaluated on the instances by the caller, backends may push down
+// the terms they can handle natively to save on the results size.
+package query
+
+import (
+	"net"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// Operators
+const (
+	OpEqual    Op = "="
+	OpNotEqual Op = "!="
+	OpMatch    Op = "~"
+	OpNotMatch Op = "!~"
+)
+
+// Fields
+const (
+	FieldID           = "id"
+	FieldBackend      = "backend"
+	FieldBackendName  = "backend_name"
+	FieldName         = "name"
+	FieldType         = "type"
+	FieldStatus       = "status"
+	FieldPrivateIP    = "private_ip"
+	FieldPublicIP     = "public_ip"
+	FieldIP           = "ip" // private or public ip
+	FieldRegion       = "region"
+	FieldZone         = "zone"
+	FieldAccount      = "account"
+	FieldLabelsPrefix = "labels."
+	FieldRawPrefix    = "raw."
+)
+
+var (
+	fields = map[string]struct{}{
+		FieldID:          {},
+		FieldBackend:     {},
+		FieldBackendName: {},
+		FieldName:        {},
+		FieldType:        {},
+		FieldStatus:      {},
+		FieldPrivateIP:   {},
+		FieldPublicIP:    {},
+		FieldIP:          {},
+		FieldRegion:      {},
+		FieldZone:        {},
+		FieldAccount:     {},
+	}
+)
+
+type (
+	// Op is a term operator
+	Op string
+
+	// Term is a single `field op value` condition
+	Term struct {
+		Field string
+		Op    Op
+		Value string
+	}
+
+	// Terms is a list of terms which must all match
+	Terms []*Term
+
+	// Query is the parsed query
+	Query struct {
+		// Pattern is the free text part of the query
+		Pattern string
+		// Patterns are the free text patterns of a search of several
+		// filters, ORed, Pattern is empty then. The backends which can
+		// search them at once tag the instances with the patterns they
+		// match. They aren't part of String, the results are cached per
+		// pattern.
+		Patterns []string
+		Terms    Terms
+	}
+)
+
+// Parse parses the query string
+func Parse(s string) (*Query, error) {
+	words, err := split(s)
+	if err != nil {
+		return nil, err
+	}
+
+	q := new(Query)
+	patterns := make([]string, 0)
+	for _, word := range words {
+		t, ok, err := parseTerm(word)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			patterns = append(patterns, word)
+
+			continue
+		}
+
+		q.Terms = append(q.Terms, t)
+	}
+
+	q.Pattern = strings.Join(patterns, " ")
+
+	return q, nil
+}
+
+// IsEmpty returns true if the query has nothing to search for
+func (q *Query) IsEmpty() bool {
+	return q.Pattern == "" && len(q.Patterns) == 0 && len(q.Terms) == 0
+}
+
+// String returns the canonical form of the query
+func (q *Query) String() string {
+	parts := make([]string, 0, len(q.Terms)+1)
+	if q.Pattern != "" {
+		parts = append(parts, quote(q.Pattern))
+	}
+
+	for _, t := range q.Terms {
+		parts = append(parts, t.String())
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// Field returns the terms of the field
+func (ts Terms) Field(field string) Terms {
+	out := make(Terms, 0)
+	for _, t := range ts {
+		if t.Field == field {
+			out = append(out, t)
+		}
+	}
+
+	return out
+}
+
+// Without returns the terms which are not of the field
+func (ts Terms) Without(field string) Terms {
+	out := make(Terms, 0)
+	for _, t := range ts {
+		if t.Field != field {
+			out = append(out, t)
+		}
+	}
+
+	return out
+}
+
+// Match returns true if all the terms match the values returned by
+// get for the term field
+func (ts Terms) Match(get func(field string) []string) bool {
+	for _, t := range ts {
+		if !t.Match(get(t.Field)...) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// String returns the term as it was written
+func (t *Term) String() string {
+	return t.Field + string(t.Op) + quote(t.Value)
+}
+
+// Negative returns true if the term excludes the matching values
+func (t *Term) Negative() bool {
+	return t.Op == OpNotEqual || t.Op == OpNotMatch
+}
+
+// IsIP returns true if the term value is an ip address
+func (t *Term) IsIP() bool {
+	return net.ParseIP(t.Value) != nil
+}
+
+// IsCIDR returns true if the term value is a network in CIDR notation
+func (t *Term) IsCIDR() bool {
+	_, _, err := net.ParseCIDR(t.Value)
+
+	return err == nil
+}
+
+// Match returns true if any of the values matches the term, for
+// negative terms it returns true if none of them does.
+//
+// Values are compared case insensitive, `~` is a substring match and
+// a CIDR value matches the ip addresses of its network.
+func (t *Term) Match(values ...string) bool {
+	matched := false
+	for _, v := range values {
+		if t.match(v) {
+			matched = true
+
+			break
+		}
+	}
+
+	if t.Negative() {
+		return !matched
+	}
+
+	return matched
+}
+
+func (t *Term) match(v string) bool {
+	if _, network, err := net.ParseCIDR(t.Value); err == nil {
+		ip := net.ParseIP(v)
+
+		return ip != nil && network.Contains(ip)
+	}
+
+	switch t.Op {
+	case OpMatch, OpNotMatch:
+		return strings.Contains(strings.ToLower(v), strings.ToLower(t.Value))
+	default:
+		if ip := net.ParseIP(t.Value); ip != nil {
+			return ip.Equal(net.ParseIP(v))
+		}
+
+		return strings.EqualFold(v, t.Value)
+	}
+}
+
+// parseTerm parses a `field op value` word, ok is false if the word
+// isn't a term and should be used as part of the pattern
+func parseTerm(word string) (*Term, bool, error) {
+	i := strings.IndexAny(word, "!=~")
+	if i <= 0 {
+		return nil, false, nil
+	}
+
+	op := Op(word[i : i+1])
+	if op == "!" {
+		if len(word) == i+1 || (word[i+1] != '=' && word[i+1] != '~') {
+			return nil, false, nil
+		}
+
+		op = Op(word[i : i+2])
+	}
+
+	field := word[:i]
+	if !isFieldName(field) {
+		return nil, false, nil
+	}
+
+	if !strings.HasPrefix(field, FieldRawPrefix) && !strings.HasPrefix(field, FieldLabelsPrefix) {
+		field = strings.ToLower(field)
+	}
+
+	if !IsField(field) {
+		return nil, false, errors.Errorf("unknown query field %q", field)
+	}
+
+	value := word[i+len(op):]
+	if value == "" {
+		return nil, false, errors.Errorf("missing value for query field %q", field)
+	}
+
+	return &Term{
+		Field: field,
+		Op:    op,
+		Value: value,
+	}, true, nil
+}
+
+// IsField returns true if the field can be used in a query
+func IsField(field string) bool {
+	for _, prefix := range []string{FieldRawPrefix, FieldLabelsPrefix} {
+		if strings.HasPrefix(field, prefix) && len(field) > len(prefix) {
+			return true
+		}
+	}
+
+	_, ok := fields[field]
+
+	return ok
+}
+
+func isFieldName(s string) bool {
+	for i, r := range s {
+		if unicode.IsLetter(r) || r == '_' || (i > 0 && (unicode.IsDigit(r) || r == '.' || r == '-' || r == '#')) {
+			continue
+		}
+
+		return false
+	}
+
+	return s != ""
+}
+
+// split splits the query into words, double quotes can be used to keep
+// spaces in a value, e.g. name="my instance"
+func split(s string) ([]string, error) {
+	words := make([]string, 0)
+
+	var (
+		word    strings.Builder
+		inQuote bool
+		hasWord bool
+	)
+
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			hasWord = true
+		case unicode.IsSpace(r) && !inQuote:
+			if hasWord {
+				words = append(words, word.String())
+			}
+
+			word.Reset()
+			hasWord = false
+		default:
+			word.WriteRune(r)
+			hasWord = true
+		}
+	}
+
+	if inQuote {
+		return nil, errors.New("unterminated quote in query")
+	}
+
+	if hasWord {
+		words = append(words, word.String())
+	}
+
+	return words, nil
+}
+
+func quote(s string) string {
+	if strings.ContainsAny(s, " \t\"") {
+		return `"` + strings.ReplaceAll(s, `"`, ``) + `"`
+	}
+
+	return s
+}
+
+// ParseNetwork returns the network of a pattern which is an ip address
+// or a network in CIDR notation, nil otherwise. An ip address is
+// returned as a single address network.
+func ParseNetwork(pattern string) *net.IPNet {
+	if _, network, err := net.ParseCIDR(pattern); err == nil {
+		return network
+	}
+
+	ip := net.ParseIP(pattern)
+	if ip == nil {
+		return nil
+	}
+
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 8*net.IPv4len
+	}
+
+	return &net.IPNet{
+		IP:   ip,
+		Mask: net.CIDRMask(bits, bits),
+	}
+}
+
+// NetworkContains returns true if any of the ip addresses is in the network
+func NetworkContains(network *net.IPNet, ips ...string) bool {
+	for _, s := range ips {
+		if ip := net.ParseIP(s); ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsSingleIP returns true if the network is a single ip address
+func IsSingleIP(network *net.IPNet) bool {
+	ones, bits := network.Mask.Size()
+
+	return ones == bits
+}
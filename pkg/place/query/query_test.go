@@ -0,0 +1,82 @@
+package query
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query   string
+		pattern string
+		terms   string
+	}{
+		{"", "", ""},
+		{"api", "api", ""},
+		{"api status=running", "api", "status=running"},
+		{"Status!=stopped name~canary", "", "status!=stopped name~canary"},
+		{`name="my instance" api`, "api", `name="my instance"`},
+		{"labels.Env=prod raw.Tags!~x", "", "labels.Env=prod raw.Tags!~x"},
+		{"private_ip=10.0.0.0/8", "", "private_ip=10.0.0.0/8"},
+		// not terms
+		{"=api a!b 1a=b", "=api a!b 1a=b", ""},
+	}
+
+	for _, tt := range tests {
+		q, err := Parse(tt.query)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.query, err)
+
+			continue
+		}
+
+		if q.Pattern != tt.pattern {
+			t.Errorf("Parse(%q) pattern = %q, want %q", tt.query, q.Pattern, tt.pattern)
+		}
+
+		if got := (&Query{Terms: q.Terms}).String(); got != tt.terms {
+			t.Errorf("Parse(%q) terms = %q, want %q", tt.query, got, tt.terms)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, s := range []string{
+		"foo=bar",
+		"api STATUS=",
+		"status!~",
+		"labels.=prod",
+		`name="my instance`,
+	} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) didn't fail", s)
+		}
+	}
+}
+
+func TestTermMatch(t *testing.T) {
+	tests := []struct {
+		term   string
+		values []string
+		want   bool
+	}{
+		{"status=running", []string{"Running"}, true},
+		{"status!=running", []string{"running"}, false},
+		{"name~API", []string{"my-api"}, true},
+		{"name!~api", []string{"db", "cache"}, true},
+		{"ip=10.0.0.0/24", []string{"", "10.0.0.7"}, true},
+		{"ip=10.0.0.0/24", []string{"10.0.1.7"}, false},
+		{"ip=::ffff:10.0.0.1", []string{"10.0.0.1"}, true},
+		{"status=running", nil, false},
+	}
+
+	for _, tt := range tests {
+		q, err := Parse(tt.term)
+		if err != nil || len(q.Terms) != 1 {
+			t.Fatalf("Parse(%q) = %v, %v", tt.term, q, err)
+		}
+
+		if got := q.Terms[0].Match(tt.values...); got != tt.want {
+			t.Errorf("%s match %v = %v, want %v", tt.term, tt.values, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package place
+
+import (
+	"sort"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/bringg/honey/pkg/place/query"
+)
+
+type (
+	// Group is the instances sharing the value of the group by path
+	Group struct {
+		Key       string
+		Instances Printable
+	}
+)
+
+// Get returns the value of the gjson path in the instance, the paths
+// are the same as the output keys, e.g. name, labels.env or raw.tags
+func (i *Instance) Get(path string) gjson.Result {
+	b, err := i.flatten()
+	if err != nil {
+		log.Debugf("can't flatten %s: %v", i.ID, err)
+
+		return gjson.Result{}
+	}
+
+	return gjson.GetBytes(b, path)
+}
+
+// SortBy sorts the instances by the value of the gjson path, see Get,
+// the instances without a value are last. Ties are ordered by backend
+// name, name and id, so the order doesn't depend on which backend
+// answered first. An empty path only orders the ties.
+func (p Printable) SortBy(path string, reverse bool) {
+	keys := make(map[*Instance]gjson.Result, len(p))
+	if path != "" {
+		for _, i := range p {
+			keys[i] = i.Get(path)
+		}
+	}
+
+	sort.SliceStable(p, func(a, b int) bool {
+		if path != "" {
+			ka, kb := keys[p[a]], keys[p[b]]
+			if less, ok := CompareValues(ka, kb, reverse); ok {
+				return less
+			}
+		}
+
+		if p[a].BackendName != p[b].BackendName {
+			return p[a].BackendName < p[b].BackendName
+		}
+
+		if p[a].Name != p[b].Name {
+			return p[a].Name < p[b].Name
+		}
+
+		return p[a].ID < p[b].ID
+	})
+}
+
+// Rank orders the instances by their best score for the matchers, the
+// best matches first, see Instance.Score. Ties keep their order.
+func (p Printable) Rank(matchers []*query.Matcher) {
+	scores := make(map[*Instance]float64, len(p))
+	for _, i := range p {
+		for _, m := range matchers {
+			if score := i.Score(m); score > scores[i] {
+				scores[i] = score
+			}
+		}
+	}
+
+	sort.SliceStable(p, func(a, b int) bool {
+		return scores[p[a]] > scores[p[b]]
+	})
+}
+
+// CompareValues compares two sort values, ok is false if they are
+// equal. Missing and null values are last whatever the order.
+func CompareValues(a, b gjson.Result, reverse bool) (less bool, ok bool) {
+	hasA, hasB := a.Exists() && a.Type != gjson.Null, b.Exists() && b.Type != gjson.Null
+
+	switch {
+	case !hasA && !hasB:
+		return false, false
+	case !hasA:
+		return false, true
+	case !hasB:
+		return true, true
+	case a.Less(b, false):
+		return !reverse, true
+	case b.Less(a, false):
+		return reverse, true
+	}
+
+	return false, false
+}
+
+// GroupBy groups the instances by the value of the gjson path, the
+// groups are sorted by key and keep the order of the instances
+func (p Printable) GroupBy(path string) []*Group {
+	groups := make(map[string]*Group)
+	for _, i := range p {
+		key := i.Get(path).String()
+
+		g, ok := groups[key]
+		if !ok {
+			g = &Group{Key: key}
+			groups[key] = g
+		}
+
+		g.Instances = append(g.Instances, i)
+	}
+
+	sorted := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		sorted = append(sorted, g)
+	}
+
+	sort.Slice(sorted, func(a, b int) bool {
+		return sorted[a].Key < sorted[b].Key
+	})
+
+	return sorted
+}
@@ -0,0 +1,46 @@
+package place
+
+import (
+	"testing"
+)
+
+func TestSortAndGroupByLabel(t *testing.T) {
+	p := Printable{
+		{Model: Model{ID: "i-1", BackendName: "aws", Name: "api", Labels: map[string]string{"CostCenter": "b"}}},
+		{Model: Model{ID: "i-2", BackendName: "aws", Name: "db"}},
+		{Model: Model{ID: "i-3", BackendName: "aws", Name: "web", Labels: map[string]string{"CostCenter": "a"}}},
+		{Model: Model{ID: "i-4", BackendName: "aws", Name: "cache", Labels: map[string]string{"CostCenter": "b"}}},
+	}
+
+	p.SortBy("labels.CostCenter", false)
+
+	want := []string{"i-3", "i-1", "i-4", "i-2"}
+	for n, i := range p {
+		if i.ID != want[n] {
+			t.Fatalf("sorted %s at %d, want %v", i.ID, n, want)
+		}
+	}
+
+	p.SortBy("labels.CostCenter", true)
+	if p[0].ID != "i-1" || p[3].ID != "i-2" {
+		t.Errorf("reverse sorted %s first and %s last, want i-1 and i-2", p[0].ID, p[3].ID)
+	}
+
+	groups := p.GroupBy("labels.CostCenter")
+	if len(groups) != 3 {
+		t.Fatalf("got %d groups, want 3", len(groups))
+	}
+
+	for n, want := range []struct {
+		key string
+		len int
+	}{{"", 1}, {"a", 1}, {"b", 2}} {
+		if groups[n].Key != want.key || len(groups[n].Instances) != want.len {
+			t.Errorf("group %d is %q of %d instances, want %q of %d", n, groups[n].Key, len(groups[n].Instances), want.key, want.len)
+		}
+	}
+
+	if got := p[0].Get("labels.cost_center"); got.Exists() {
+		t.Errorf("labels.cost_center = %s, want the provider key only", got.Raw)
+	}
+}
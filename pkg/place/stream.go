@@ -0,0 +1,45 @@
+package place
+
+import (
+	"context"
+)
+
+// SendPage sends the page on out, it gives up if ctx is done before
+// the page is received so a stream never outlives its search. Empty
+// pages are not sent.
+func SendPage(ctx context.Context, out chan<- Printable, page Printable) error {
+	if len(page) == 0 {
+		return nil
+	}
+
+	select {
+	case out <- page:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Collect runs the stream and returns all the pages it sent, it is
+// used by the streaming backends to implement List
+func Collect(stream func(out chan<- Printable) error) (Printable, error) {
+	out := make(chan Printable)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(out)
+
+		errc <- stream(out)
+	}()
+
+	instances := make(Printable, 0)
+	for page := range out {
+		instances = append(instances, page...)
+	}
+
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+
+	return instances, nil
+}
@@ -2,8 +2,12 @@ package place
 
 import (
 	"context"
+	"time"
 
+	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/config/configmap"
+
+	"github.com/bringg/honey/pkg/place/query"
 )
 
 // Constants Option.Hide
@@ -21,6 +25,33 @@ type (
 		List(ctx context.Context, backendName string, pattern string) (Printable, error)
 	}
 
+	// Querier is an optional interface for backends which can push the
+	// query terms down to the provider, e.g. as EC2 filters. The caller
+	// evaluates all the terms on the results anyway, so a backend only
+	// pushes down the terms it can handle natively. The Patterns of the
+	// query are searched at once, the instances matching any of them
+	// are returned with Instance.Patterns set to the ones they match.
+	Querier interface {
+		ListQuery(ctx context.Context, backendName string, q *query.Query) (Printable, error)
+	}
+
+	// Streamer is an optional interface for backends which get the
+	// instances in pages, e.g. per EC2 region or GCP page. Stream sends
+	// every page on out as soon as it arrives and returns once all of
+	// them were sent, it doesn't close out. Like ListQuery, terms are
+	// pushed down where possible and evaluated by the caller anyway,
+	// and the instances of several Patterns are tagged.
+	Streamer interface {
+		Stream(ctx context.Context, backendName string, q *query.Query, out chan<- Printable) error
+	}
+
+	// Getter is an optional interface for backends which can fetch a
+	// single instance by its id, with its full raw details. It returns
+	// ErrInstanceNotFound if there is no such instance.
+	Getter interface {
+		Get(ctx context.Context, backendName string, id string) (*Instance, error)
+	}
+
 	// Commander is an interface to wrap the Command function
 	Commander interface {
 		// Command the backend to run a named command
@@ -36,13 +67,20 @@ type (
 	}
 
 	Model struct {
-		ID          string `json:"id"`
-		BackendName string `json:"backend_name" mapstructure:"backend_name"`
-		Name        string `json:"name"`
-		Type        string `json:"type"`
-		Status      string `json:"status"`
-		PrivateIP   string `json:"private_ip" mapstructure:"private_ip"`
-		PublicIP    string `json:"public_ip" mapstructure:"public_ip"`
+		ID          string            `json:"id"`
+		BackendName string            `json:"backend_name" mapstructure:"backend_name"`
+		Name        string            `json:"name"`
+		Type        string            `json:"type"`
+		Status      string            `json:"status"`
+		PrivateIP   string            `json:"private_ip" mapstructure:"private_ip"`
+		PublicIP    string            `json:"public_ip" mapstructure:"public_ip"`
+		Region      string            `json:"region"`
+		Zone        string            `json:"zone"`
+		Account     string            `json:"account"` // AWS account, GCP project, k8s cluster...
+		CreatedAt   *time.Time        `json:"created_at" mapstructure:"created_at"`
+		Labels      map[string]string `json:"labels"`   // EC2 tags, GCP labels, k8s pod labels, Consul node meta...
+		Sources     []string          `json:"sources"`  // backend_name/id of the merged instances, see Printable.Merge
+		Patterns    []string          `json:"patterns"` // the filters matched when several are searched
 	}
 
 	// Instance _
@@ -71,6 +109,17 @@ type (
 		CommandHelp []CommandHelp
 	}
 
+	// CommonOptions are the options shared by all the backends
+	CommonOptions struct {
+		Timeout          fs.Duration `config:"timeout"`
+		QPS              float64     `config:"qps"`
+		Burst            int         `config:"burst"`
+		SyncInterval     fs.Duration `config:"sync_interval"`
+		CacheTTL         fs.Duration `config:"cache_ttl"`
+		NoCache          bool        `config:"no_cache"`
+		NegativeCacheTTL fs.Duration `config:"negative_cache_ttl"`
+	}
+
 	// Options is a slice of configuration Option for a backend
 	Options []Option
 
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+
+	"github.com/bringg/honey/pkg/place"
+	"github.com/bringg/honey/pkg/place/operations"
+)
+
+// Instance returns a single instance of the backend by its id, the id
+// may contain slashes, e.g. a k8s namespace/name
+func Instance() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		instance, err := operations.Get(c.Request().Context(), c.Param("backend"), c.Param("*"))
+		if err != nil {
+			if errors.Is(err, place.ErrInstanceNotFound) {
+				return echo.NewHTTPError(http.StatusNotFound, err.Error())
+			}
+
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		data := place.Printable{instance}
+
+		flattenData, err := data.FlattenData()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		cleanedData, err := flattenData.Filter(append(data.Headers(), "raw"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.JSONPretty(http.StatusOK, &InstanceResponse{Data: cleanedData[0]}, "   ")
+	}
+}
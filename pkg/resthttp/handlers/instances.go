@@ -3,22 +3,31 @@ package handlers
 import (
 	"context"
 	"fmt"
+	"mime"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 
 	lru "github.com/hnlq715/golang-lru"
+	jsoniter "github.com/json-iterator/go"
 	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
 	"github.com/vcraescu/go-paginator/v2/adapter"
 
 	"github.com/bringg/honey/pkg/place"
 	"github.com/bringg/honey/pkg/place/operations"
+	"github.com/bringg/honey/pkg/place/printers"
 )
 
 const (
 	lrySize      = 100
 	defaultLimit = 10
+
+	mimeCSV = "text/csv"
+	mimeTSV = "text/tab-separated-values"
 )
 
 var (
@@ -28,13 +37,69 @@ var (
 
 func Instances() echo.HandlerFunc {
 	return func(c echo.Context) error {
-		instances, err := getInstances(c)
+		resp, err := getInstances(c)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 		}
 
-		return c.JSONPretty(http.StatusOK, instances, "   ")
+		if format, noHeaders := delimitedFormat(c.Request().Header.Get(echo.HeaderAccept)); format != "" {
+			return writeDelimited(c, format, noHeaders, resp)
+		}
+
+		return c.JSONPretty(http.StatusOK, resp, "   ")
+	}
+}
+
+// lruEntry is the search result kept in the lru cache
+type lruEntry struct {
+	data []map[string]interface{}
+	keys []string
+	ages map[string]*operations.DataAge
+}
+
+// anyStale returns true if the data of a backend is being refreshed
+func anyStale(ages map[string]*operations.DataAge) bool {
+	for _, age := range ages {
+		if age.Stale {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setAgeHeaders sets the age in seconds of the data of every backend,
+// e.g. `X-Data-Age: aws=192;stale, gcp=0`, and the Age of the oldest
+func setAgeHeaders(c echo.Context, ages map[string]*operations.DataAge) {
+	names := make([]string, 0, len(ages))
+	for name := range ages {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var oldest int64
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		seconds := int64(ages[name].Age().Seconds())
+		if seconds > oldest {
+			oldest = seconds
+		}
+
+		part := fmt.Sprintf("%s=%d", name, seconds)
+		if ages[name].Stale {
+			part += ";stale"
+		}
+
+		parts = append(parts, part)
+	}
+
+	if len(parts) == 0 {
+		return
 	}
+
+	c.Response().Header().Set("X-Data-Age", strings.Join(parts, ", "))
+	c.Response().Header().Set("Age", strconv.FormatInt(oldest, 10))
 }
 
 func getPositiveInt(i string) int {
@@ -58,32 +123,75 @@ func mustCreateLRU() *lru.ARCCache {
 	return l
 }
 
-func lruKey(c echo.Context) string {
-	return fmt.Sprintf("%s:%s", c.QueryParam("filter"), strings.Join(c.Request().URL.Query()["backend"], ":"))
+func lruKey(c echo.Context, ci *place.ConfigInfo) string {
+	return fmt.Sprintf("%s:%t:%s:%q:%s:%q", ci.MatchMode, ci.IgnoreCase, ci.Merge, c.Request().URL.Query()["filter"], strings.Join(c.Request().URL.Query()["backend"], ":"), c.Request().URL.Query()["key"])
+}
+
+// setSearchConfig sets the search params on the request config
+func setSearchConfig(c echo.Context, ci *place.ConfigInfo) error {
+	if match := c.QueryParam("match"); match != "" {
+		ci.MatchMode = match
+	}
+
+	if ignoreCase := c.QueryParam("ignore_case"); ignoreCase != "" {
+		v, err := strconv.ParseBool(ignoreCase)
+		if err != nil {
+			return errors.Wrap(err, "invalid ignore_case param")
+		}
+
+		ci.IgnoreCase = v
+	}
+
+	// merge=true merges on all the rules
+	if merge := c.QueryParam("merge"); merge != "" {
+		if v, err := strconv.ParseBool(merge); err == nil {
+			merge = ""
+			if v {
+				merge = strings.Join(place.MergeRules, ",")
+			}
+		}
+
+		ci.Merge = merge
+	}
+
+	return nil
 }
 
-func getInstances(c echo.Context) ([]map[string]interface{}, error) {
-	filter := c.QueryParam("filter")
+func getInstances(c echo.Context) (*InstancesResponse, error) {
+	filters := c.Request().URL.Query()["filter"]
 	backends := c.Request().URL.Query()["backend"]
 	keys := c.Request().URL.Query()["key"]
-	key := lruKey(c)
 
-	var cleanedData []map[string]interface{}
+	ci := place.GetConfig(c.Request().Context())
+	if err := setSearchConfig(c, ci); err != nil {
+		return nil, err
+	}
+
+	key := lruKey(c, ci)
+
+	warnings := make([]Warning, 0)
+
+	var (
+		cleanedData []map[string]interface{}
+		ages        map[string]*operations.DataAge
+	)
+
 	if items, ok := lruCache.Get(key); ok {
-		cleanedData = items.([]map[string]interface{})
+		entry := items.(*lruEntry)
+		cleanedData, keys, ages = entry.data, entry.keys, entry.ages
 	} else {
-		instances, err := operations.Find(c.Request().Context(), backends, filter)
+		res, err := operations.Find(c.Request().Context(), backends, filters)
 		if err != nil {
 			return nil, err
 		}
 
-		flattenData, err := instances.FlattenData()
+		flattenData, err := res.Instances.FlattenData()
 		if err != nil {
 			return nil, err
 		}
 
 		if len(keys) == 0 {
-			keys = instances.Headers()
+			keys = res.Instances.Headers()
 		}
 
 		cleanedData, err = flattenData.Filter(append(keys, "raw"))
@@ -91,10 +199,35 @@ func getInstances(c echo.Context) ([]map[string]interface{}, error) {
 			return nil, err
 		}
 
-		lruCache.Add(key, cleanedData)
+		for _, e := range res.Errors {
+			warnings = append(warnings, Warning{
+				Backend:  e.Backend,
+				Error:    e.Err.Error(),
+				TimedOut: e.TimedOut,
+			})
+		}
+
+		ages = res.Ages
+
+		// don't keep partial or stale results, the next request should
+		// retry the failed backends and get the refreshed ones
+		if len(warnings) == 0 && !anyStale(ages) {
+			lruCache.Add(key, &lruEntry{data: cleanedData, keys: keys, ages: ages})
+		}
+	}
+
+	setAgeHeaders(c, ages)
+
+	if path := c.QueryParam("_sort"); path != "" {
+		sorted, err := sortData(cleanedData, path, strings.EqualFold(c.QueryParam("_order"), "desc"))
+		if err != nil {
+			return nil, err
+		}
+
+		cleanedData = sorted
 	}
 
-	var data []map[string]interface{}
+	data := make([]map[string]interface{}, 0)
 	adp := adapter.NewSliceAdapter(cleanedData)
 
 	limit := getPositiveInt(c.QueryParam("_end"))
@@ -113,5 +246,98 @@ func getInstances(c echo.Context) ([]map[string]interface{}, error) {
 
 	c.Response().Header().Add("X-Total-Count", strconv.FormatInt(total, 10))
 
-	return data, nil
+	return &InstancesResponse{
+		Data:     data,
+		Warnings: warnings,
+		Keys:     keys,
+	}, nil
+}
+
+// sortData returns a copy of the data sorted by the gjson path, the
+// data may be shared by the lru cache
+func sortData(data []map[string]interface{}, path string, desc bool) ([]map[string]interface{}, error) {
+	keys := make([]gjson.Result, len(data))
+	for i, item := range data {
+		b, err := jsoniter.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+
+		keys[i] = gjson.GetBytes(b, path)
+	}
+
+	idx := make([]int, len(data))
+	for i := range idx {
+		idx[i] = i
+	}
+
+	sort.SliceStable(idx, func(a, b int) bool {
+		less, _ := place.CompareValues(keys[idx[a]], keys[idx[b]], desc)
+
+		return less
+	})
+
+	sorted := make([]map[string]interface{}, len(data))
+	for n, i := range idx {
+		sorted[n] = data[i]
+	}
+
+	return sorted, nil
+}
+
+// delimitedFormat returns csv or tsv if the accept header asks for
+// them, empty for json. noHeaders is set by the header=absent param of
+// text/csv, see RFC 4180.
+func delimitedFormat(accept string) (format string, noHeaders bool) {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		switch mediaType {
+		case "application/json", "*/*":
+			return "", false
+		case mimeCSV:
+			return "csv", params["header"] == "absent"
+		case mimeTSV:
+			return "tsv", params["header"] == "absent"
+		}
+	}
+
+	return "", false
+}
+
+// writeDelimited writes the instances as csv or tsv, the nested values
+// are flattened like the csv output of the cli and the warnings are
+// Warning headers
+func writeDelimited(c echo.Context, format string, noHeaders bool, resp *InstancesResponse) error {
+	rows := make([][]string, len(resp.Data))
+	for n, item := range resp.Data {
+		row := make([]string, len(resp.Keys))
+		for k, key := range resp.Keys {
+			b, err := jsoniter.Marshal(item[key])
+			if err != nil {
+				return err
+			}
+
+			row[k] = place.FormatValue(gjson.ParseBytes(b))
+		}
+
+		rows[n] = row
+	}
+
+	for _, w := range resp.Warnings {
+		c.Response().Header().Add("Warning", fmt.Sprintf("199 honey %q", w.Backend+": "+w.Error))
+	}
+
+	write, contentType := printers.WriteCSV, mimeCSV
+	if format == "tsv" {
+		write, contentType = printers.WriteTSV, mimeTSV
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, contentType+"; charset=utf-8")
+	c.Response().WriteHeader(http.StatusOK)
+
+	return write(c.Response(), resp.Keys, rows, noHeaders)
 }
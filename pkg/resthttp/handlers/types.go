@@ -10,4 +10,23 @@ type (
 	BackendsResponse struct {
 		Data []Backend `json:"data"`
 	}
+
+	// Warning describes a backend which failed to answer
+	Warning struct {
+		Backend  string `json:"backend"`
+		Error    string `json:"error"`
+		TimedOut bool   `json:"timed_out"`
+	}
+
+	InstancesResponse struct {
+		Data     []map[string]interface{} `json:"data"`
+		Warnings []Warning                `json:"warnings"`
+		// Keys are the keys of the data, without raw, the columns of
+		// the csv and tsv responses
+		Keys []string `json:"-"`
+	}
+
+	InstanceResponse struct {
+		Data map[string]interface{} `json:"data"`
+	}
 )
@@ -145,6 +145,8 @@ func (s *Server) Serve() error {
 			},
 			ExposeHeaders: []string{
 				"X-Total-Count",
+				"X-Data-Age",
+				"Age",
 			},
 			MaxAge: 1728000,
 		}))
@@ -184,6 +186,7 @@ func (s *Server) Serve() error {
 	// Routes
 	api.GET("/backends", handlers.Backends())
 	api.GET("/instances", handlers.Instances())
+	api.GET("/instances/:backend/*", handlers.Instance())
 
 	// Start server
 	go func() {
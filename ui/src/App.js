@@ -1,12 +1,26 @@
 import * as React from "react";
-import { Admin, Resource, AppBar, Layout } from 'react-admin';
+import { Admin, Resource, AppBar, Layout, fetchUtils } from 'react-admin';
 import jsonServerProvider from 'ra-data-json-server';
 import InstanceIcon from '@material-ui/icons/Book';
 import BackendIcon from '@material-ui/icons/Satellite';
 import { InstanceList, InstanceShow } from './instances';
 import { BackendList } from './backends';
 
-const dataProvider = jsonServerProvider('api/v1');
+// instances are returned with the warnings of the failed backends,
+// unwrap them so react-admin gets the list of whatever did answer
+const httpClient = (url, options = {}) =>
+    fetchUtils.fetchJson(url, options).then(response => {
+        const { json } = response;
+        if (json && Array.isArray(json.data)) {
+            (json.warnings || []).forEach(w => console.warn(`backend ${w.backend} failed: ${w.error}`));
+
+            return { ...response, json: json.data };
+        }
+
+        return response;
+    });
+
+const dataProvider = jsonServerProvider('api/v1', httpClient);
 
 const CustomAppBar = props => <AppBar {...props} userMenu={false} />;
 const CustomLayout = props => <Layout {...props} appBar={CustomAppBar} />;
@@ -3,9 +3,11 @@ import {
     ReferenceArrayInput,
     SelectArrayInput,
     TextInput,
+    BooleanInput,
     List,
     Datagrid,
     TextField,
+    DateField,
     SimpleForm,
     Show,
     SimpleShowLayout
@@ -21,6 +23,7 @@ const InstanceFilter = (props) => (
         <ReferenceArrayInput alwaysOn label="Backend" source="backend" reference="backends">
             <SelectArrayInput optionText="name" optionValue="name" />
         </ReferenceArrayInput>
+        <BooleanInput label="Merge hosts" source="merge" />
     </Filter>
 );
 
@@ -60,6 +63,10 @@ export const InstanceList = (props) => (
             <TextField source="public_ip" />
             <TextField source="status" />
             <TextField source="type" />
+            <TextField source="region" />
+            <TextField source="zone" />
+            <TextField source="account" />
+            <DateField source="created_at" showTime />
         </Datagrid>
     </List>
 );